@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The renewer keeps the secrets of a subject up to date. It is installed by
+// an init container of its image into a volume shared with the renewal
+// sidecar, which runs it in the daytona image:
+//
+//	renewer install <path>
+//	renewer run [flags] -- <daytona command>
+//	renewer ready <ready file>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/signals"
+
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+	"github.com/dgerd/daytona-binding/pkg/renewal"
+)
+
+// reloadTimeout bounds a request to the reload endpoint of the application.
+const reloadTimeout = 10 * time.Second
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: renewer install|run|ready ...")
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "install":
+		if len(args) != 1 {
+			err = fmt.Errorf("usage: renewer install <path>")
+			break
+		}
+		err = renewal.Install(args[0])
+	case "ready":
+		if len(args) != 1 {
+			err = fmt.Errorf("usage: renewer ready <ready file>")
+			break
+		}
+		err = renewal.Ready(args[0])
+	case "run":
+		err = run(args)
+	default:
+		err = fmt.Errorf("unknown command %q, must be one of install, run or ready", cmd)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run renews the secrets until the renewer is terminated.
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	interval := fs.Duration("interval", 0, "The time between two runs of daytona.")
+	threshold := fs.Int("failure-threshold", 1, "The number of consecutive failed runs after which the renewer is no longer ready.")
+	secretsDir := fs.String("secrets-dir", daytona.SecretMountPath, "The directory daytona writes the secrets to.")
+	readyFile := fs.String("ready-file", daytona.RenewerReadyFile, "The file that exists while the renewer is ready.")
+	ignore := fs.String("ignore", "", "A file of the secrets directory that changes on every run, such as the Vault token.")
+	signal := fs.String("reload-signal", "", "The signal sent to the container to reload, e.g. SIGHUP.")
+	url := fs.String("reload-url", "", "The reload endpoint POSTed to, e.g. http://localhost:8080/-/reload.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("--interval must be positive, was %v", *interval)
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: renewer run [flags] -- <daytona command>")
+	}
+
+	r := &renewal.Renewer{
+		Command:          fs.Args(),
+		Interval:         *interval,
+		FailureThreshold: *threshold,
+		SecretsDir:       *secretsDir,
+		ReadyFile:        *readyFile,
+	}
+	if *ignore != "" {
+		r.Ignore = []string{*ignore}
+	}
+	switch {
+	case *signal != "" && *url != "":
+		return fmt.Errorf("--reload-signal and --reload-url are mutually exclusive")
+	case *signal != "":
+		sig, err := renewal.ParseSignal(*signal)
+		if err != nil {
+			return err
+		}
+		r.Reloader = &renewal.Signaller{
+			Env:    daytona.ReloadTargetEnv + "=" + daytona.ReloadTargetEnv,
+			Signal: sig,
+		}
+	case *url != "":
+		r.Reloader = &renewal.HTTPReloader{
+			URL:    *url,
+			Client: &http.Client{Timeout: reloadTimeout},
+		}
+	}
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+	ctx := logging.WithLogger(signals.NewContext(), logger.Sugar())
+	return r.Run(ctx)
+}
@@ -18,8 +18,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
@@ -36,12 +38,15 @@ import (
 	"knative.dev/pkg/webhook/resourcesemantics/defaulting"
 	"knative.dev/pkg/webhook/resourcesemantics/validation"
 
+	"github.com/dgerd/daytona-binding/pkg/admission"
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
 	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
 	"github.com/dgerd/daytona-binding/pkg/reconciler/daytona"
+	"github.com/dgerd/daytona-binding/pkg/reconciler/readiness"
 )
 
 var types = map[schema.GroupVersionKind]resourcesemantics.GenericCRD{
-	v1alpha1.SchemeGroupVersion.WithKind("DaytonaBinding"):         &v1alpha1.DaytonaBinding{},
+	v1alpha1.SchemeGroupVersion.WithKind("DaytonaBinding"): &v1alpha1.DaytonaBinding{},
 }
 
 func NewDefaultingAdmissionController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
@@ -66,7 +71,11 @@ func NewDefaultingAdmissionController(ctx context.Context, cmw configmap.Watcher
 }
 
 func NewValidationAdmissionController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
-	return validation.NewAdmissionController(ctx,
+	// Decorate contexts with the current state of the config.
+	store := config.NewStore(logging.FromContext(ctx).Named("config-store"))
+	store.WatchConfigs(cmw)
+
+	return admission.WithWarnings(validation.NewAdmissionController(ctx,
 		// Name of the resource webhook.
 		"validation.webhook.binding.app",
 
@@ -77,13 +86,28 @@ func NewValidationAdmissionController(ctx context.Context, cmw configmap.Watcher
 		types,
 
 		// A function that infuses the context passed to Validate/SetDefaults with custom metadata.
-		func(ctx context.Context) context.Context {
-			return ctx
-		},
+		store.ToContext,
 
 		// Whether to disallow unknown fields.
 		true,
-	)
+	), bindingWarnings(store))
+}
+
+// bindingWarnings returns the risks the DaytonaBindings being admitted put
+// their subjects at, under the current policy.
+func bindingWarnings(store *config.Store) admission.Warner {
+	gvk := v1alpha1.SchemeGroupVersion.WithKind("DaytonaBinding")
+	return func(ctx context.Context, request *admissionv1beta1.AdmissionRequest) []string {
+		if request.Operation == admissionv1beta1.Delete ||
+			request.Kind.Group != gvk.Group || request.Kind.Kind != gvk.Kind {
+			return nil
+		}
+		var db v1alpha1.DaytonaBinding
+		if err := json.Unmarshal(request.Object.Raw, &db); err != nil {
+			return nil
+		}
+		return db.Warnings(store.ToContext(ctx))
+	}
 }
 
 func NewConfigValidationController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
@@ -97,15 +121,21 @@ func NewConfigValidationController(ctx context.Context, cmw configmap.Watcher) *
 
 		// The configmaps to validate.
 		configmap.Constructors{
-			logging.ConfigMapName(): logging.NewConfigFromConfigMap,
-			metrics.ConfigMapName(): metrics.NewObservabilityConfigFromConfigMap,
+			logging.ConfigMapName():  logging.NewConfigFromConfigMap,
+			metrics.ConfigMapName():  metrics.NewObservabilityConfigFromConfigMap,
+			config.DaytonaConfigName: config.NewDaytonaFromConfigMap,
 		},
 	)
 }
 
 func NewBindingWebhook(resource string, gla podbinding.GetListAll, wc podbinding.BindableContext) injection.ControllerConstructor {
 	return func(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
-		return podbinding.NewAdmissionController(ctx,
+		// Decorate contexts with the current state of the config, so that
+		// policy changes apply to the next Pod we admit.
+		store := config.NewStore(logging.FromContext(ctx).Named("config-store"))
+		store.WatchConfigs(cmw)
+
+		return admission.Decorate(ctx, podbinding.NewAdmissionController(ctx,
 			// Name of the resource webhook.
 			fmt.Sprintf("%s.webhook.binding.app", resource),
 
@@ -116,8 +146,10 @@ func NewBindingWebhook(resource string, gla podbinding.GetListAll, wc podbinding
 			gla,
 
 			// How to setup the context prior to invoking Do/Undo.
-			wc,
-		)
+			func(ctx context.Context, b podbinding.Bindable) (context.Context, error) {
+				return wc(store.ToContext(ctx), b)
+			},
+		))
 	}
 }
 
@@ -133,16 +165,26 @@ func main() {
 		return ctx, nil
 	}
 
+	// Serves the admission controllers for both admission.k8s.io/v1 and
+	// v1beta1, in place of the webhook of sharedmain.
+	server := admission.NewServer()
+
 	sharedmain.MainWithContext(ctx, "webhook",
 		// Our singleton certificate controller.
 		certificates.NewController,
 
 		// Our singleton webhook admission controllers
-		NewDefaultingAdmissionController,
-		NewValidationAdmissionController,
-		NewConfigValidationController,
+		server.Serve(NewDefaultingAdmissionController),
+		server.Serve(NewValidationAdmissionController),
+		server.Serve(NewConfigValidationController),
 
 		// For each binding we have a controller and a binding webhook.
-		daytona.NewController, NewBindingWebhook("daytonabindings", daytona.ListAll, nop),
+		daytona.NewController, server.Serve(NewBindingWebhook("daytonabindings", daytona.ListAll, nop)),
+
+		// Keeps the secrets-ready readiness gate of the subjects in sync.
+		readiness.NewController,
+
+		// Serves the admission controllers above.
+		server.NewController,
 	)
 }
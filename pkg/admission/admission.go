@@ -0,0 +1,205 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/markbates/inflect"
+	"go.uber.org/zap"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/webhook"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/audit"
+	"github.com/dgerd/daytona-binding/pkg/decision"
+	"github.com/dgerd/daytona-binding/pkg/metrics"
+)
+
+// Reconciler wraps the podbinding admission controller so that the denials
+// recorded via decision.Deny are turned into a rejected admission response.
+type Reconciler struct {
+	*podbinding.Reconciler
+
+	// serviceName is the name of the Service fronting the webhook.
+	serviceName string
+
+	// optOut is whether only the objects and namespaces labeled for
+	// inclusion are intercepted.
+	optOut bool
+
+	// auditor delivers the admission decisions to the audit sinks.
+	auditor *audit.Sink
+}
+
+var _ controller.Reconciler = (*Reconciler)(nil)
+var _ webhook.AdmissionController = (*Reconciler)(nil)
+
+// Admit implements AdmissionController
+func (ac *Reconciler) Admit(ctx context.Context, request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	start := time.Now()
+	// The server records the warnings of the decision in the response.
+	d, ok := decision.From(ctx)
+	if !ok {
+		ctx, d = decision.With(ctx)
+	}
+	resp := ac.admit(ctx, d, request)
+	b := d.Binding()
+
+	logger := logging.FromContext(ctx)
+	if err := metrics.ReportAdmission(ctx, resp.Allowed, time.Since(start)); err != nil {
+		logger.Warnw("Failed to report admission", zap.Error(err))
+	}
+	// Only the subjects of a Bindable are worth counting, the rest of the
+	// Pods in their namespaces are let through untouched.
+	if b == nil {
+		return resp
+	}
+	if isDryRun(b) {
+		if err := metrics.ReportDryRun(ctx, b.GetNamespace(), b.GetName()); err != nil {
+			logger.Warnw("Failed to report dry run", zap.Error(err))
+		}
+	} else if !resp.Allowed || mutated(resp) {
+		if err := metrics.ReportMutation(ctx, b.GetNamespace(), b.GetName(), resp.Allowed); err != nil {
+			logger.Warnw("Failed to report mutation", zap.Error(err))
+		}
+	}
+	// The decision is audited to the sink of the binding that handled the
+	// subject, not to those of the other bindings in its namespace.
+	ac.audit(ctx, b, request, resp)
+	return resp
+}
+
+// isDryRun returns whether the provided binding only records what it would
+// do to its subjects.
+func isDryRun(b kmeta.Accessor) bool {
+	dr, ok := b.(DryRunner)
+	return ok && dr.IsDryRun()
+}
+
+// audit sends the decision made about the subject of the provided binding
+// to its audit sink, if it has one.
+func (ac *Reconciler) audit(ctx context.Context, b kmeta.Accessor, request *admissionv1beta1.AdmissionRequest, resp *admissionv1beta1.AdmissionResponse) {
+	a, ok := b.(audit.Auditable)
+	if !ok || ac.auditor == nil {
+		return
+	}
+	sink := a.AuditSink()
+	if sink == nil {
+		return
+	}
+
+	var obj struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}
+	if err := json.Unmarshal(request.Object.Raw, &obj); err != nil {
+		logging.FromContext(ctx).Warnw("Failed to decode the object to audit", zap.Error(err))
+	}
+	role, paths := a.AuditVault()
+	// Objects from informers have no TypeMeta.
+	var gvk schema.GroupVersionKind
+	if o, ok := b.(kmeta.OwnerRefable); ok {
+		gvk = o.GetGroupVersionKind()
+	} else {
+		gvk = b.GroupVersionKind()
+	}
+	verdict := audit.Decision{
+		Subject: audit.Object{
+			Kind:         request.Kind.Kind,
+			Namespace:    request.Namespace,
+			Name:         obj.Name,
+			GenerateName: obj.GenerateName,
+		},
+		Binding: audit.Object{
+			Kind:      gvk.Kind,
+			Namespace: b.GetNamespace(),
+			Name:      b.GetName(),
+		},
+		Operation:   string(request.Operation),
+		Allowed:     resp.Allowed,
+		DryRun:      isDryRun(b),
+		Role:        role,
+		SecretPaths: paths,
+	}
+	if resp.Result != nil {
+		verdict.Reason = resp.Result.Message
+	}
+	ac.auditor.Send(sink, audit.Event{
+		ID: string(request.UID),
+		Source: fmt.Sprintf("/apis/%s/namespaces/%s/%s/%s", gvk.GroupVersion(), b.GetNamespace(),
+			strings.ToLower(inflect.Pluralize(gvk.Kind)), b.GetName()),
+		Time: time.Now(),
+		Data: verdict,
+	})
+}
+
+func (ac *Reconciler) admit(ctx context.Context, d *decision.Decision, request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	resp := ac.Reconciler.Admit(ctx, request)
+
+	if denials := d.Denials(); len(denials) > 0 {
+		return webhook.MakeErrorStatus("%s", strings.Join(denials, "; "))
+	}
+	return resp
+}
+
+// mutated returns whether the provided response patches the object.
+func mutated(resp *admissionv1beta1.AdmissionResponse) bool {
+	var ops []json.RawMessage
+	if err := json.Unmarshal(resp.Patch, &ops); err != nil {
+		return false
+	}
+	return len(ops) > 0
+}
+
+// Reconcile implements controller.Reconciler
+func (ac *Reconciler) Reconcile(ctx context.Context, key string) error {
+	// Have podbinding index the Bindables, before we program the webhook
+	// entries that send their subjects our way.
+	if err := ac.Reconciler.Reconcile(ctx, key); err != nil {
+		return err
+	}
+	return ac.reconcileWebhooks(ctx)
+}
+
+// Decorate swaps the reconciler of the provided podbinding admission
+// controller for one that honors decision.Deny, and that programs separate webhook
+// entries for the subjects of critical and non-critical Bindables.
+func Decorate(ctx context.Context, impl *controller.Impl) *controller.Impl {
+	pb := impl.Reconciler.(*podbinding.Reconciler)
+
+	auditor := audit.NewSink(&http.Client{Timeout: audit.DefaultTimeout},
+		logging.FromContext(ctx).Named("audit"), audit.DefaultQueueSize)
+	go auditor.Run(ctx)
+
+	impl.Reconciler = &Reconciler{
+		Reconciler:  pb,
+		serviceName: webhook.GetOptions(ctx).ServiceName,
+		optOut:      podbinding.HasOptOutSelector(ctx),
+		auditor:     auditor,
+	}
+	return impl
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	admissionlisters "k8s.io/client-go/listers/admissionregistration/v1beta1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/system"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook"
+	certresources "knative.dev/pkg/webhook/certificates/resources"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/audit"
+	"github.com/dgerd/daytona-binding/pkg/decision"
+)
+
+// handlingBindable is a Bindable that records which of its kind ran Do.
+type handlingBindable struct {
+	bindable
+	name string
+	ran  *[]string
+	sink *apis.URL
+}
+
+func (b *handlingBindable) GetNamespace() string               { return "default" }
+func (b *handlingBindable) GetName() string                    { return b.name }
+func (b *handlingBindable) GetDeletionTimestamp() *metav1.Time { return nil }
+func (b *handlingBindable) GetGroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{}
+}
+
+func (b *handlingBindable) AuditSink() *apis.URL           { return b.sink }
+func (b *handlingBindable) AuditVault() (string, []string) { return "", nil }
+
+func (b *handlingBindable) Do(ctx context.Context, pod *duckv1.WithPodable) {
+	decision.Handled(ctx, b)
+	*b.ran = append(*b.ran, b.name)
+}
+
+// handlingReconciler returns a Reconciler with the provided Bindables
+// indexed for admission.
+func handlingReconciler(t *testing.T, fbs ...podbinding.Bindable) *Reconciler {
+	t.Helper()
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	secrets.Add(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "binding-system", Name: "webhook-certs"},
+		Data:       map[string][]byte{certresources.CACert: []byte("ca")},
+	})
+	// Without webhook entries to program, the configuration is left as is.
+	mwhs := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	mwhs.Add(&admissionregistrationv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "bindings.example.com"},
+	})
+
+	ac := &Reconciler{Reconciler: &podbinding.Reconciler{
+		Name:         "bindings.example.com",
+		SecretName:   "webhook-certs",
+		MWHLister:    admissionlisters.NewMutatingWebhookConfigurationLister(mwhs),
+		SecretLister: corelisters.NewSecretLister(secrets),
+		ListAll: func() ([]podbinding.Bindable, error) {
+			return fbs, nil
+		},
+	}}
+	if err := ac.Reconciler.Reconcile(context.Background(), ""); err != nil {
+		t.Fatalf("Reconcile() = %v", err)
+	}
+	return ac
+}
+
+// namedAndSelecting returns two bindings in the same namespace: one naming
+// the Pod "foo" as its subject, and one selecting every Pod.
+func namedAndSelecting() (named, selecting *handlingBindable) {
+	named = &handlingBindable{
+		bindable: bindable{subject: subject("v1", "Pod", "default")},
+		name:     "named",
+	}
+	selecting = &handlingBindable{
+		bindable: bindable{subject: tracker.Reference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  "default",
+			Selector:   &metav1.LabelSelector{},
+		}},
+		name: "selecting",
+	}
+	return named, selecting
+}
+
+// podRequest returns the request to admit the creation of the named Pod.
+func podRequest(name string) *admissionv1beta1.AdmissionRequest {
+	return &admissionv1beta1.AdmissionRequest{
+		UID:       types.UID(name),
+		Operation: admissionv1beta1.Create,
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "default",
+		Object:    runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"` + name + `"}}`)},
+	}
+}
+
+func TestAdmitHandled(t *testing.T) {
+	defer os.Setenv(system.NamespaceEnvKey, os.Getenv(system.NamespaceEnvKey))
+	os.Setenv(system.NamespaceEnvKey, "binding-system")
+
+	var ran []string
+	named, selecting := namedAndSelecting()
+	named.ran, selecting.ran = &ran, &ran
+	ac := handlingReconciler(t, named, selecting)
+
+	for _, pod := range []string{"foo", "bar"} {
+		ran = nil
+		ctx, d := decision.With(context.Background())
+		resp := ac.admit(ctx, d, podRequest(pod))
+		if !resp.Allowed {
+			t.Fatalf("admit(%s) = %+v, wanted allowed", pod, resp)
+		}
+		if len(ran) != 1 {
+			t.Fatalf("admit(%s) ran Do of %v, wanted exactly one binding", pod, ran)
+		}
+		if b := d.Binding(); b == nil || b.GetName() != ran[0] {
+			t.Errorf("admit(%s) recorded %v, wanted the binding whose Do ran, %s", pod, b, ran[0])
+		}
+	}
+}
+
+func TestAdmitAuditsHandler(t *testing.T) {
+	defer os.Setenv(system.NamespaceEnvKey, os.Getenv(system.NamespaceEnvKey))
+	os.Setenv(system.NamespaceEnvKey, "binding-system")
+
+	// Each binding has its own sink, which reports the subjects it receives.
+	received := make(chan string, 2)
+	var servers []*httptest.Server
+	defer func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}()
+	sink := func(binding string) *apis.URL {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var d audit.Decision
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				t.Errorf("Decode() = %v", err)
+			}
+			received <- binding + ":" + d.Subject.Name
+		}))
+		servers = append(servers, srv)
+		u, err := apis.ParseURL(srv.URL)
+		if err != nil {
+			t.Fatalf("ParseURL() = %v", err)
+		}
+		return u
+	}
+	var ran []string
+	named, selecting := namedAndSelecting()
+	named.ran, selecting.ran = &ran, &ran
+	named.sink, selecting.sink = sink("named"), sink("selecting")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ac := handlingReconciler(t, named, selecting)
+	ac.auditor = audit.NewSink(http.DefaultClient, zap.NewNop().Sugar(), 2)
+	go ac.auditor.Run(ctx)
+
+	for pod, want := range map[string]string{
+		"foo": "named:foo",
+		"bar": "selecting:bar",
+	} {
+		if resp := ac.Admit(ctx, podRequest(pod)); !resp.Allowed {
+			t.Fatalf("Admit(%s) = %+v, wanted allowed", pod, resp)
+		}
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("Admit(%s) audited %q, wanted %q", pod, got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for the audit event of %s", pod)
+		}
+	}
+}
+
+func TestMutated(t *testing.T) {
+	for patch, want := range map[string]bool{
+		"":     false,
+		"null": false,
+		"[]":   false,
+		`[{"op":"add","path":"/spec/initContainers","value":[]}]`: true,
+	} {
+		resp := &admissionv1beta1.AdmissionResponse{Patch: []byte(patch)}
+		if got := mutated(resp); got != want {
+			t.Errorf("mutated(%q) = %v, wanted %v", patch, got, want)
+		}
+	}
+}
+
+// auditedBindable is a Bindable with an audit sink.
+type auditedBindable struct {
+	bindable
+	sink *apis.URL
+}
+
+func (b *auditedBindable) GetNamespace() string { return "default" }
+func (b *auditedBindable) GetName() string      { return "binding" }
+func (b *auditedBindable) GetGroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "binding.app", Version: "v1alpha1", Kind: "DaytonaBinding"}
+}
+func (b *auditedBindable) AuditSink() *apis.URL { return b.sink }
+func (b *auditedBindable) AuditVault() (string, []string) {
+	return "app", []string{"secret/app"}
+}
+
+func TestAudit(t *testing.T) {
+	sink := apis.HTTP("audit.example.com")
+	received := make(chan audit.Decision, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d audit.Decision
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			t.Errorf("Decode() = %v", err)
+		}
+		if got, want := r.Header.Get("Ce-Source"), "/apis/binding.app/v1alpha1/namespaces/default/daytonabindings/binding"; got != want {
+			t.Errorf("Ce-Source = %q, wanted %q", got, want)
+		}
+		received <- d
+	}))
+	defer srv.Close()
+	sink, err := apis.ParseURL(srv.URL)
+	if err != nil {
+		t.Fatalf("ParseURL() = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ac := &Reconciler{auditor: audit.NewSink(srv.Client(), zap.NewNop().Sugar(), 1)}
+	go ac.auditor.Run(ctx)
+
+	// Bindables without an audit sink aren't audited.
+	ac.audit(ctx, &auditedBindable{}, &admissionv1beta1.AdmissionRequest{}, &admissionv1beta1.AdmissionResponse{})
+
+	ac.audit(ctx, &auditedBindable{sink: sink}, &admissionv1beta1.AdmissionRequest{
+		UID:       "1234",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "default",
+		Operation: admissionv1beta1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(`{"metadata":{"generateName":"app-"}}`)},
+	}, webhook.MakeErrorStatus("denied"))
+
+	want := audit.Decision{
+		Subject:     audit.Object{Kind: "Pod", Namespace: "default", GenerateName: "app-"},
+		Binding:     audit.Object{Kind: "DaytonaBinding", Namespace: "default", Name: "binding"},
+		Operation:   "CREATE",
+		Reason:      "denied",
+		Role:        "app",
+		SecretPaths: []string{"secret/app"},
+	}
+	select {
+	case got := <-received:
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("audit (-want, +got) = %s", diff)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the audit event")
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	secretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/injection"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+	"knative.dev/pkg/webhook"
+	certresources "knative.dev/pkg/webhook/certificates/resources"
+
+	"github.com/dgerd/daytona-binding/pkg/decision"
+)
+
+// Server serves the admission controllers with the webhook of
+// knative.dev/pkg in place of sharedmain, so that it can answer
+// admission.k8s.io/v1 AdmissionReviews as well as v1beta1 ones, and return
+// the warnings recorded with decision.Warn as the warnings kubectl prints.
+type Server struct {
+	mu  sync.Mutex
+	acs []webhook.AdmissionController
+
+	// webhook handles the AdmissionReviews of both versions, which are
+	// alike, as v1beta1 ones.
+	webhook http.Handler
+	logger  *zap.SugaredLogger
+}
+
+// NewServer returns a Server without admission controllers.
+func NewServer() *Server {
+	return &Server{
+		logger: logging.FromContext(context.Background()),
+	}
+}
+
+// admissionReconciler is the reconciler of an admission controller.
+type admissionReconciler interface {
+	controller.Reconciler
+	webhook.AdmissionController
+}
+
+// reconcilerOnly hides that a reconciler is an admission controller, so that
+// sharedmain doesn't start a webhook of its own on the port of the server.
+type reconcilerOnly struct {
+	controller.Reconciler
+}
+
+// Serve returns a constructor of the controller the provided one constructs,
+// whose admission controller is served by the server instead of sharedmain.
+func (s *Server) Serve(ctor injection.ControllerConstructor) injection.ControllerConstructor {
+	return func(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
+		impl := ctor(ctx, cmw)
+		ac, ok := impl.Reconciler.(webhook.AdmissionController)
+		if !ok {
+			return impl
+		}
+		s.mu.Lock()
+		s.acs = append(s.acs, ac)
+		s.mu.Unlock()
+		impl.Reconciler = reconcilerOnly{impl.Reconciler}
+		return impl
+	}
+}
+
+// nop reconciles nothing.
+type nop struct{}
+
+// Reconcile implements controller.Reconciler
+func (nop) Reconcile(context.Context, string) error {
+	return nil
+}
+
+// NewController starts serving the admission controllers constructed before
+// it, with the certificate the certificates controller keeps in the secret of
+// the webhook, until the context is done. sharedmain only runs controllers,
+// so it returns one that reconciles nothing.
+func (s *Server) NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
+	logger := logging.FromContext(ctx)
+	opts := webhook.GetOptions(ctx)
+	if opts == nil {
+		logger.Fatal("The context must have webhook.Options")
+	}
+
+	webhook.RegisterMetrics()
+	s.mu.Lock()
+	wh, err := webhook.New(ctx, s.acs)
+	s.mu.Unlock()
+	if err != nil {
+		logger.Fatalw("Failed to create the admission webhook", zap.Error(err))
+	}
+	s.webhook = wh
+	s.logger = logger
+
+	secrets := secretinformer.Get(ctx).Lister()
+	server := &http.Server{
+		Handler: s,
+		Addr:    fmt.Sprintf(":%d", opts.Port),
+		TLSConfig: &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				secret, err := secrets.Secrets(system.Namespace()).Get(opts.SecretName)
+				if err != nil {
+					return nil, err
+				}
+				serverKey, ok := secret.Data[certresources.ServerKey]
+				if !ok {
+					return nil, errors.New("server key missing")
+				}
+				serverCert, ok := secret.Data[certresources.ServerCert]
+				if !ok {
+					return nil, errors.New("server cert missing")
+				}
+				cert, err := tls.X509KeyPair(serverCert, serverKey)
+				if err != nil {
+					return nil, err
+				}
+				return &cert, nil
+			},
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			logger.Fatalw("Failed to serve the admission controllers", zap.Error(err))
+		}
+	}()
+
+	return controller.NewImpl(nop{}, logger, "AdmissionServer")
+}
+
+// review is an AdmissionReview of either version, whose response has the
+// warnings Kubernetes 1.19 added.
+type review struct {
+	metav1.TypeMeta `json:",inline"`
+	Response        *response `json:"response,omitempty"`
+}
+
+type response struct {
+	admissionv1beta1.AdmissionResponse `json:",inline"`
+	Warnings                           []string `json:"warnings,omitempty"`
+}
+
+// buffer holds the response of the webhook until it is completed.
+type buffer struct {
+	bytes.Buffer
+	header http.Header
+	code   int
+}
+
+// Header implements http.ResponseWriter
+func (b *buffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (b *buffer) WriteHeader(code int) {
+	b.code = code
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read body: %v", err), http.StatusBadRequest)
+		return
+	}
+	// The webhook rejects the requests that don't decode.
+	var request admissionv1beta1.AdmissionReview
+	json.Unmarshal(body, &request)
+
+	// Have the admission controllers record their warnings in the decision
+	// about the request.
+	ctx, d := decision.With(r.Context())
+	r = r.WithContext(ctx)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	b := &buffer{header: w.Header(), code: http.StatusOK}
+	s.webhook.ServeHTTP(b, r)
+
+	var out review
+	if b.code != http.StatusOK || json.Unmarshal(b.Bytes(), &out) != nil || out.Response == nil {
+		w.WriteHeader(b.code)
+		w.Write(b.Bytes())
+		return
+	}
+	// The webhook answers as v1beta1, without saying so.
+	out.APIVersion = admissionv1beta1.SchemeGroupVersion.String()
+	if request.APIVersion == admissionv1.SchemeGroupVersion.String() {
+		out.APIVersion = request.APIVersion
+	}
+	out.Kind = "AdmissionReview"
+	if out.Response.Allowed {
+		out.Response.Warnings = d.Warnings()
+	}
+	for _, warning := range out.Response.Warnings {
+		s.logger.Warnf("Admitting %s %s/%s: %s", request.Request.Kind.Kind, request.Request.Namespace, request.Request.Name, warning)
+	}
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		http.Error(w, fmt.Sprintf("could not encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// Warner returns warnings about the object of an admission request, which
+// don't prevent it from being admitted.
+type Warner func(ctx context.Context, request *admissionv1beta1.AdmissionRequest) []string
+
+// warningController records the warnings of its Warner about the requests
+// an admission controller admits.
+type warningController struct {
+	admissionReconciler
+	warner Warner
+}
+
+// Admit implements AdmissionController
+func (wc *warningController) Admit(ctx context.Context, request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	resp := wc.admissionReconciler.Admit(ctx, request)
+	if resp.Allowed {
+		for _, w := range wc.warner(ctx, request) {
+			decision.Warn(ctx, "%s", w)
+		}
+	}
+	return resp
+}
+
+// WithWarnings decorates the admission controller of the provided controller
+// so that the warnings of the provided Warner are recorded with decision.Warn
+// for the requests it admits.
+func WithWarnings(impl *controller.Impl, warner Warner) *controller.Impl {
+	impl.Reconciler = &warningController{
+		admissionReconciler: impl.Reconciler.(admissionReconciler),
+		warner:              warner,
+	}
+	return impl
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/webhook"
+
+	"github.com/dgerd/daytona-binding/pkg/decision"
+)
+
+// fakeController admits every request with the provided response.
+type fakeController struct {
+	resp admissionv1beta1.AdmissionResponse
+}
+
+var _ admissionReconciler = (*fakeController)(nil)
+
+func (*fakeController) Path() string {
+	return "/fake"
+}
+
+func (f *fakeController) Admit(context.Context, *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	resp := f.resp
+	return &resp
+}
+
+func (*fakeController) Reconcile(context.Context, string) error {
+	return nil
+}
+
+// fakeWebhook answers like the webhook of knative.dev/pkg, with a v1beta1
+// AdmissionReview without TypeMeta, after warning about the request.
+func fakeWebhook(allowed bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fake" {
+			http.Error(w, fmt.Sprintf("no admission controller registered for: %s", r.URL.Path), http.StatusBadRequest)
+			return
+		}
+		var review admissionv1beta1.AdmissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			http.Error(w, fmt.Sprintf("could not decode body: %v", err), http.StatusBadRequest)
+			return
+		}
+		decision.Warn(r.Context(), "first")
+		decision.Warn(r.Context(), "second")
+
+		jsonPatch := admissionv1beta1.PatchTypeJSONPatch
+		json.NewEncoder(w).Encode(admissionv1beta1.AdmissionReview{
+			Response: &admissionv1beta1.AdmissionResponse{
+				UID:       review.Request.UID,
+				Allowed:   allowed,
+				Patch:     []byte(`[]`),
+				PatchType: &jsonPatch,
+			},
+		})
+	})
+}
+
+func TestServe(t *testing.T) {
+	s := NewServer()
+	ctor := s.Serve(func(context.Context, configmap.Watcher) *controller.Impl {
+		return &controller.Impl{Reconciler: &fakeController{}}
+	})
+	impl := ctor(context.Background(), nil)
+	if _, ok := impl.Reconciler.(webhook.AdmissionController); ok {
+		t.Error("Serve() left the admission controller for sharedmain to serve")
+	}
+	if len(s.acs) != 1 {
+		t.Errorf("Serve() registered %d admission controllers, wanted 1", len(s.acs))
+	}
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		version string
+		allowed bool
+		want    []string
+	}{{
+		version: "admission.k8s.io/v1",
+		allowed: true,
+		want:    []string{"first", "second"},
+	}, {
+		version: "admission.k8s.io/v1beta1",
+		allowed: true,
+		want:    []string{"first", "second"},
+	}, {
+		version: "admission.k8s.io/v1",
+	}}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s allowed=%v", test.version, test.allowed), func(t *testing.T) {
+			s := NewServer()
+			s.webhook = fakeWebhook(test.allowed)
+
+			body, err := json.Marshal(map[string]interface{}{
+				"apiVersion": test.version,
+				"kind":       "AdmissionReview",
+				"request": map[string]interface{}{
+					"uid":       "abc",
+					"kind":      map[string]string{"version": "v1", "kind": "Pod"},
+					"operation": "CREATE",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/fake", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("ServeHTTP() = %d %s", rec.Code, rec.Body)
+			}
+
+			var got struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Response   struct {
+					UID       types.UID `json:"uid"`
+					Allowed   bool      `json:"allowed"`
+					PatchType string    `json:"patchType"`
+					Warnings  []string  `json:"warnings"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() = %v", err)
+			}
+			if got.APIVersion != test.version || got.Kind != "AdmissionReview" {
+				t.Errorf("ServeHTTP() = %s %s, wanted %s AdmissionReview", got.APIVersion, got.Kind, test.version)
+			}
+			if got.Response.UID != "abc" || got.Response.Allowed != test.allowed || got.Response.PatchType != "JSONPatch" {
+				t.Errorf("Response = %+v, wanted the JSONPatch of abc with allowed=%v", got.Response, test.allowed)
+			}
+			if diff := cmp.Diff(test.want, got.Response.Warnings); diff != "" {
+				t.Errorf("Warnings (-want, +got) = %s", diff)
+			}
+		})
+	}
+
+	// The errors of the webhook are passed through.
+	s := NewServer()
+	s.webhook = fakeWebhook(true)
+	req := httptest.NewRequest(http.MethodPost, "/unknown", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("ServeHTTP() of an unknown path = %d, wanted %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestWithWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed bool
+		want    []string
+	}{{
+		name:    "allowed",
+		allowed: true,
+		want:    []string{"careful", "really"},
+	}, {
+		name: "denied",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			impl := WithWarnings(&controller.Impl{
+				Reconciler: &fakeController{resp: admissionv1beta1.AdmissionResponse{Allowed: test.allowed}},
+			}, func(context.Context, *admissionv1beta1.AdmissionRequest) []string {
+				return []string{"careful", "really"}
+			})
+
+			ac := impl.Reconciler.(webhook.AdmissionController)
+			ctx, d := decision.With(context.Background())
+			ac.Admit(ctx, &admissionv1beta1.AdmissionRequest{})
+			if diff := cmp.Diff(test.want, d.Warnings()); diff != "" {
+				t.Errorf("Warnings (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/markbates/inflect"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"knative.dev/pkg/kmp"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
+	"knative.dev/pkg/system"
+	certresources "knative.dev/pkg/webhook/certificates/resources"
+	"knative.dev/pkg/webhook/podbinding"
+)
+
+// NamespaceNameLabel is the label Kubernetes sets on every namespace to its
+// name, as of 1.21, which lets a webhook's namespaceSelector select
+// namespaces by name.
+const NamespaceNameLabel = "kubernetes.io/metadata.name"
+
+// namespaceNameLabelMinor is the first minor version of Kubernetes 1 that
+// sets NamespaceNameLabel.
+const namespaceNameLabelMinor = 21
+
+// FailurePolicied is implemented by Bindables that declare whether the
+// admission of their subjects must fail when the webhook can't be called.
+// Bindables that don't implement it are treated as critical, i.e. Fail.
+type FailurePolicied interface {
+	GetFailurePolicy() admissionregistrationv1beta1.FailurePolicyType
+}
+
+// DryRunner is implemented by Bindables that may be set to only record what
+// they would do to their subjects, which are then counted apart.
+type DryRunner interface {
+	IsDryRun() bool
+}
+
+// webhookName returns the name of the webhook entry we program for the
+// provided failure policy.
+func webhookName(base string, policy admissionregistrationv1beta1.FailurePolicyType) string {
+	return strings.ToLower(string(policy)) + "." + base
+}
+
+// reconcileWebhooks programs the webhook entries of our
+// MutatingWebhookConfiguration, as planned by entries: the subjects of the
+// critical Bindables are sent to an entry that fails closed, and the others
+// to one that fails open; there is no entry at all while there are no
+// Bindables.
+//
+// The objectSelector stays the exclusion (or, in opt-out mode, inclusion)
+// selector: the subjects of a Bindable may be selected by name, and a single
+// selector can't express the union of the selectors of several Bindables.
+//
+// podbinding only programs the entry named after the configuration, which
+// would intercept every Pod failing closed, so we remove that entry and
+// leave podbinding to maintaining its index of Bindables.
+func (ac *Reconciler) reconcileWebhooks(ctx context.Context) error {
+	secret, err := ac.SecretLister.Secrets(system.Namespace()).Get(ac.SecretName)
+	if err != nil {
+		return err
+	}
+	caCert, ok := secret.Data[certresources.CACert]
+	if !ok {
+		return fmt.Errorf("secret %q is missing %q key", ac.SecretName, certresources.CACert)
+	}
+
+	fbs, err := ac.ListAll()
+	if err != nil {
+		return err
+	}
+	rules, err := rulesFor(fbs)
+	if err != nil {
+		return err
+	}
+	critical, relaxed := namespaces(fbs)
+	labeled, err := LabelsNamespaces(ac.Client.Discovery())
+	if err != nil {
+		return err
+	}
+
+	configured, err := ac.MWHLister.Get(ac.Name)
+	if err != nil {
+		return fmt.Errorf("error retrieving webhook: %w", err)
+	}
+	existing := make(map[string]admissionregistrationv1beta1.MutatingWebhook, len(configured.Webhooks))
+	mwh := configured.DeepCopy()
+	mwh.Webhooks = nil
+	for _, wh := range configured.Webhooks {
+		existing[wh.Name] = wh
+		switch wh.Name {
+		case ac.Name, webhookName(ac.Name, admissionregistrationv1beta1.Fail), webhookName(ac.Name, admissionregistrationv1beta1.Ignore):
+			// These are ours to program.
+		default:
+			mwh.Webhooks = append(mwh.Webhooks, wh)
+		}
+	}
+
+	entry := func(policy admissionregistrationv1beta1.FailurePolicyType, namespaces []string) admissionregistrationv1beta1.MutatingWebhook {
+		name := webhookName(ac.Name, policy)
+		// Start from what is there, so that the fields the API server
+		// defaults don't look like drift.
+		wh := existing[name]
+		wh.Name = name
+		wh.AdmissionReviewVersions = []string{"v1", "v1beta1"}
+		wh.ClientConfig.CABundle = caCert
+		wh.ClientConfig.URL = nil
+		if wh.ClientConfig.Service == nil {
+			wh.ClientConfig.Service = &admissionregistrationv1beta1.ServiceReference{}
+		}
+		wh.ClientConfig.Service.Namespace = system.Namespace()
+		wh.ClientConfig.Service.Name = ac.serviceName
+		wh.ClientConfig.Service.Path = ptr.String(ac.Path())
+		wh.Rules = rules
+		wh.FailurePolicy = &policy
+		matchPolicy := admissionregistrationv1beta1.Equivalent
+		wh.MatchPolicy = &matchPolicy
+
+		selector := ac.selector()
+		wh.ObjectSelector = selector.DeepCopy()
+		wh.NamespaceSelector = namespaceSelector(selector, namespaces)
+		return wh
+	}
+	for _, e := range entries(critical, relaxed, labeled) {
+		mwh.Webhooks = append(mwh.Webhooks, entry(e.policy, e.namespaces))
+	}
+
+	if ok, err := kmp.SafeEqual(configured, mwh); err != nil {
+		return fmt.Errorf("error diffing webhooks: %w", err)
+	} else if ok {
+		return nil
+	}
+	logging.FromContext(ctx).Infof("Updating webhook entries, failing closed for namespaces %v and open for %v, selecting namespaces by name: %v",
+		critical.List(), relaxed.List(), labeled)
+	if _, err := ac.Client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Update(mwh); err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return nil
+}
+
+// webhookEntry is a webhook entry programmed by reconcileWebhooks.
+type webhookEntry struct {
+	policy admissionregistrationv1beta1.FailurePolicyType
+
+	// namespaces are the names of the namespaces the entry selects, or nil
+	// for all of those the exclusion selector doesn't exclude.
+	namespaces []string
+}
+
+// entries returns the webhook entries to program for the provided critical
+// and relaxed namespaces, as returned by namespaces.
+//
+// Where namespaces are labeled with their name, the entries only select the
+// namespaces holding subjects, so that the rest of the cluster is neither
+// slowed down nor blocked by the webhook. As a namespaceSelector is the
+// finest grain the API server routes on, a namespace holding any critical
+// Bindable is critical as a whole.
+//
+// Elsewhere, a selector naming namespaces would select none, so a single
+// entry selects every namespace the exclusion selector lets through, as
+// podbinding does. It fails closed as soon as any Bindable is critical, so
+// that critical subjects are never admitted without their injection, at the
+// cost of blocking the Pods of the whole cluster while the webhook is down.
+func entries(critical, relaxed sets.String, labeled bool) []webhookEntry {
+	var es []webhookEntry
+	switch {
+	case !labeled && critical.Len() > 0:
+		es = append(es, webhookEntry{policy: admissionregistrationv1beta1.Fail})
+	case !labeled && relaxed.Len() > 0:
+		es = append(es, webhookEntry{policy: admissionregistrationv1beta1.Ignore})
+	case labeled:
+		if critical.Len() > 0 {
+			es = append(es, webhookEntry{policy: admissionregistrationv1beta1.Fail, namespaces: critical.List()})
+		}
+		if relaxed.Len() > 0 {
+			es = append(es, webhookEntry{policy: admissionregistrationv1beta1.Ignore, namespaces: relaxed.List()})
+		}
+	}
+	return es
+}
+
+// namespaceSelector returns the provided exclusion (or inclusion) selector,
+// narrowed to the named namespaces unless they are nil. The exclusion
+// selector is kept either way, so that the namespaces the webhook is told
+// to leave alone are never intercepted.
+func namespaceSelector(selector metav1.LabelSelector, namespaces []string) *metav1.LabelSelector {
+	selector = *selector.DeepCopy()
+	if namespaces != nil {
+		selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      NamespaceNameLabel,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   namespaces,
+		})
+	}
+	return &selector
+}
+
+// LabelsNamespaces returns whether the API server labels every namespace
+// with its name under NamespaceNameLabel, which it does as of Kubernetes
+// 1.21.
+func LabelsNamespaces(client discovery.ServerVersionInterface) (bool, error) {
+	info, err := client.ServerVersion()
+	if err != nil {
+		return false, fmt.Errorf("failed to read the server version: %w", err)
+	}
+	// Some providers suffix the minor version, e.g. "20+".
+	major, err := strconv.Atoi(strings.TrimSuffix(info.Major, "+"))
+	if err != nil {
+		return false, fmt.Errorf("malformed server major version %q: %w", info.Major, err)
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(info.Minor, "+"))
+	if err != nil {
+		return false, fmt.Errorf("malformed server minor version %q: %w", info.Minor, err)
+	}
+	return major > 1 || (major == 1 && minor >= namespaceNameLabelMinor), nil
+}
+
+// Programmed returns an error describing how the entries reconcileWebhooks
+// programs in the provided MutatingWebhookConfiguration fall short of
+// intercepting the subjects of the provided Bindable, or nil when they
+// don't. labeled is whether namespaces are labeled with their name, as
+// returned by LabelsNamespaces, without which the entries selecting
+// namespaces by name select none. As the webhook reconciles its
+// configuration asynchronously, a Bindable is expected not to be programmed
+// for a short while after it changes.
+func Programmed(mwh *admissionregistrationv1beta1.MutatingWebhookConfiguration, fb podbinding.Bindable, labeled bool) error {
+	ref := fb.GetSubject()
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return err
+	}
+	resource := strings.ToLower(inflect.Pluralize(ref.Kind)) + "/*"
+
+	for _, wh := range mwh.Webhooks {
+		var policy admissionregistrationv1beta1.FailurePolicyType
+		switch wh.Name {
+		case webhookName(mwh.Name, admissionregistrationv1beta1.Fail):
+			policy = admissionregistrationv1beta1.Fail
+		case webhookName(mwh.Name, admissionregistrationv1beta1.Ignore):
+			policy = admissionregistrationv1beta1.Ignore
+		default:
+			continue
+		}
+		if !selectsNamespace(wh.NamespaceSelector, ref.Namespace, labeled) {
+			continue
+		}
+		if fp, ok := fb.(FailurePolicied); (!ok || fp.GetFailurePolicy() != admissionregistrationv1beta1.Ignore) &&
+			policy != admissionregistrationv1beta1.Fail {
+			return fmt.Errorf("the webhook fails open in namespace %q", ref.Namespace)
+		}
+		for _, rule := range wh.Rules {
+			if sets.NewString(rule.APIGroups...).Has(gv.Group) &&
+				sets.NewString(rule.APIVersions...).Has(gv.Version) &&
+				sets.NewString(rule.Resources...).Has(resource) {
+				return nil
+			}
+		}
+		return fmt.Errorf("the webhook doesn't intercept %s in namespace %q", ref.Kind, ref.Namespace)
+	}
+	return fmt.Errorf("the webhook doesn't select namespace %q", ref.Namespace)
+}
+
+// selectsNamespace returns whether the provided namespaceSelector, as
+// programmed by reconcileWebhooks, selects the provided namespace: when it
+// lists namespaces by name, whether they are labeled with it and it lists
+// the namespace, and otherwise whether the namespace isn't excluded, which
+// is assumed.
+func selectsNamespace(selector *metav1.LabelSelector, namespace string, labeled bool) bool {
+	if selector == nil {
+		return true
+	}
+	for _, req := range selector.MatchExpressions {
+		if req.Key == NamespaceNameLabel && req.Operator == metav1.LabelSelectorOpIn {
+			return labeled && sets.NewString(req.Values...).Has(namespace)
+		}
+	}
+	return true
+}
+
+// namespaces returns the namespaces holding the subjects of the provided
+// Bindables, split between those holding a subject of a Bindable that
+// doesn't fail open and the others.
+func namespaces(fbs []podbinding.Bindable) (critical, relaxed sets.String) {
+	critical, all := sets.NewString(), sets.NewString()
+	for _, fb := range fbs {
+		ns := fb.GetSubject().Namespace
+		all.Insert(ns)
+		if fp, ok := fb.(FailurePolicied); !ok || fp.GetFailurePolicy() != admissionregistrationv1beta1.Ignore {
+			critical.Insert(ns)
+		}
+	}
+	return critical, all.Difference(critical)
+}
+
+// selector returns the selector excluding (or, in opt-out mode, including)
+// the objects and namespaces podbinding is told to.
+func (ac *Reconciler) selector() metav1.LabelSelector {
+	if ac.optOut {
+		return *podbinding.InclusionSelector.DeepCopy()
+	}
+	return *podbinding.ExclusionSelector.DeepCopy()
+}
+
+// rulesFor returns the rules intercepting Pods, and the kinds of the
+// subjects of the provided Bindables, as podbinding does.
+func rulesFor(fbs []podbinding.Bindable) ([]admissionregistrationv1beta1.RuleWithOperations, error) {
+	gks := map[schema.GroupKind]sets.String{
+		corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(): sets.NewString("v1"),
+	}
+	for _, fb := range fbs {
+		ref := fb.GetSubject()
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		gk := schema.GroupKind{Group: gv.Group, Kind: ref.Kind}
+		if gks[gk] == nil {
+			gks[gk] = sets.NewString()
+		}
+		gks[gk].Insert(gv.Version)
+	}
+
+	rules := make([]admissionregistrationv1beta1.RuleWithOperations, 0, len(gks))
+	for gk, versions := range gks {
+		plural := strings.ToLower(inflect.Pluralize(gk.Kind))
+		rules = append(rules, admissionregistrationv1beta1.RuleWithOperations{
+			Operations: []admissionregistrationv1beta1.OperationType{
+				admissionregistrationv1beta1.Create,
+				admissionregistrationv1beta1.Update,
+			},
+			Rule: admissionregistrationv1beta1.Rule{
+				APIGroups:   []string{gk.Group},
+				APIVersions: versions.List(),
+				Resources:   []string{plural + "/*"},
+			},
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		lhs, rhs := rules[i], rules[j]
+		if lhs.APIGroups[0] != rhs.APIGroups[0] {
+			return lhs.APIGroups[0] < rhs.APIGroups[0]
+		}
+		if lhs.APIVersions[0] != rhs.APIVersions[0] {
+			return lhs.APIVersions[0] < rhs.APIVersions[0]
+		}
+		return lhs.Resources[0] < rhs.Resources[0]
+	})
+	return rules, nil
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgotesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook/podbinding"
+)
+
+// bindable is a Bindable with just enough implemented for the webhook
+// entries to be computed from it.
+type bindable struct {
+	podbinding.Bindable
+	subject tracker.Reference
+}
+
+func (b *bindable) GetSubject() tracker.Reference {
+	return b.subject
+}
+
+type policiedBindable struct {
+	bindable
+	policy admissionregistrationv1beta1.FailurePolicyType
+}
+
+func (b *policiedBindable) GetFailurePolicy() admissionregistrationv1beta1.FailurePolicyType {
+	return b.policy
+}
+
+func subject(apiVersion, kind, namespace string) tracker.Reference {
+	return tracker.Reference{APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: "foo"}
+}
+
+func TestNamespaces(t *testing.T) {
+	fbs := []podbinding.Bindable{
+		&bindable{subject: subject("apps/v1", "Deployment", "legacy")},
+		&policiedBindable{
+			bindable: bindable{subject: subject("apps/v1", "Deployment", "critical")},
+			policy:   admissionregistrationv1beta1.Fail,
+		},
+		&policiedBindable{
+			bindable: bindable{subject: subject("apps/v1", "Deployment", "relaxed")},
+			policy:   admissionregistrationv1beta1.Ignore,
+		},
+		&policiedBindable{
+			bindable: bindable{subject: subject("apps/v1", "Deployment", "mixed")},
+			policy:   admissionregistrationv1beta1.Ignore,
+		},
+		&policiedBindable{
+			bindable: bindable{subject: subject("batch/v1", "Job", "mixed")},
+			policy:   admissionregistrationv1beta1.Fail,
+		},
+	}
+
+	critical, relaxed := namespaces(fbs)
+	if diff := cmp.Diff([]string{"critical", "legacy", "mixed"}, critical.List()); diff != "" {
+		t.Errorf("critical namespaces (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff([]string{"relaxed"}, relaxed.List()); diff != "" {
+		t.Errorf("relaxed namespaces (-want, +got) = %s", diff)
+	}
+
+	critical, relaxed = namespaces(nil)
+	if critical.Len() != 0 || relaxed.Len() != 0 {
+		t.Errorf("namespaces(nil) = %v, %v, wanted none", critical.List(), relaxed.List())
+	}
+}
+
+func TestEntries(t *testing.T) {
+	tests := []struct {
+		name              string
+		critical, relaxed []string
+		labeled           bool
+		want              []webhookEntry
+	}{{
+		name:     "labeled",
+		critical: []string{"critical", "mixed"},
+		relaxed:  []string{"relaxed"},
+		labeled:  true,
+		want: []webhookEntry{{
+			policy:     admissionregistrationv1beta1.Fail,
+			namespaces: []string{"critical", "mixed"},
+		}, {
+			policy:     admissionregistrationv1beta1.Ignore,
+			namespaces: []string{"relaxed"},
+		}},
+	}, {
+		name:    "labeled relaxed",
+		relaxed: []string{"relaxed"},
+		labeled: true,
+		want: []webhookEntry{{
+			policy:     admissionregistrationv1beta1.Ignore,
+			namespaces: []string{"relaxed"},
+		}},
+	}, {
+		name:     "unlabeled",
+		critical: []string{"critical"},
+		relaxed:  []string{"relaxed"},
+		want: []webhookEntry{{
+			policy: admissionregistrationv1beta1.Fail,
+		}},
+	}, {
+		name:    "unlabeled relaxed",
+		relaxed: []string{"relaxed"},
+		want: []webhookEntry{{
+			policy: admissionregistrationv1beta1.Ignore,
+		}},
+	}, {
+		name:    "no bindings",
+		labeled: true,
+	}, {
+		name: "unlabeled without bindings",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := entries(sets.NewString(test.critical...), sets.NewString(test.relaxed...), test.labeled)
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(webhookEntry{})); diff != "" {
+				t.Errorf("entries (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestNamespaceSelector(t *testing.T) {
+	exclusion := *podbinding.ExclusionSelector.DeepCopy()
+
+	got := namespaceSelector(exclusion, []string{"critical", "mixed"})
+	want := exclusion.DeepCopy()
+	want.MatchExpressions = append(want.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      NamespaceNameLabel,
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   []string{"critical", "mixed"},
+	})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("namespaceSelector(namespaces) (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(&exclusion, namespaceSelector(exclusion, nil)); diff != "" {
+		t.Errorf("namespaceSelector(nil) (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(podbinding.ExclusionSelector, exclusion); diff != "" {
+		t.Errorf("namespaceSelector() mutated its selector (-want, +got) = %s", diff)
+	}
+}
+
+func TestLabelsNamespaces(t *testing.T) {
+	tests := []struct {
+		major, minor string
+		want         bool
+		wantErr      bool
+	}{
+		{major: "1", minor: "14"},
+		{major: "1", minor: "20+"},
+		{major: "1", minor: "21", want: true},
+		{major: "1", minor: "22+", want: true},
+		{major: "2", minor: "0", want: true},
+		{major: "1", minor: "", wantErr: true},
+	}
+	for _, test := range tests {
+		client := &fakediscovery.FakeDiscovery{
+			Fake:               &clientgotesting.Fake{},
+			FakedServerVersion: &version.Info{Major: test.major, Minor: test.minor},
+		}
+		got, err := LabelsNamespaces(client)
+		if (err != nil) != test.wantErr {
+			t.Errorf("LabelsNamespaces(%s.%s) = %v, wantErr %v", test.major, test.minor, err, test.wantErr)
+		} else if got != test.want {
+			t.Errorf("LabelsNamespaces(%s.%s) = %v, want %v", test.major, test.minor, got, test.want)
+		}
+	}
+}
+
+func TestRulesFor(t *testing.T) {
+	fbs := []podbinding.Bindable{
+		&bindable{subject: subject("apps/v1", "Deployment", "default")},
+		&bindable{subject: subject("apps/v1beta2", "Deployment", "default")},
+		&bindable{subject: subject("batch/v1", "Job", "default")},
+	}
+	ops := []admissionregistrationv1beta1.OperationType{
+		admissionregistrationv1beta1.Create,
+		admissionregistrationv1beta1.Update,
+	}
+	want := []admissionregistrationv1beta1.RuleWithOperations{{
+		Operations: ops,
+		Rule: admissionregistrationv1beta1.Rule{
+			APIGroups:   []string{""},
+			APIVersions: []string{"v1"},
+			Resources:   []string{"pods/*"},
+		},
+	}, {
+		Operations: ops,
+		Rule: admissionregistrationv1beta1.Rule{
+			APIGroups:   []string{"apps"},
+			APIVersions: []string{"v1", "v1beta2"},
+			Resources:   []string{"deployments/*"},
+		},
+	}, {
+		Operations: ops,
+		Rule: admissionregistrationv1beta1.Rule{
+			APIGroups:   []string{"batch"},
+			APIVersions: []string{"v1"},
+			Resources:   []string{"jobs/*"},
+		},
+	}}
+
+	got, err := rulesFor(fbs)
+	if err != nil {
+		t.Fatalf("rulesFor() = %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("rulesFor (-want, +got) = %s", diff)
+	}
+
+	if _, err := rulesFor([]podbinding.Bindable{&bindable{subject: subject("a/b/c", "Foo", "default")}}); err == nil {
+		t.Error("rulesFor() = nil, wanted an error for a malformed apiVersion")
+	}
+}
+
+func TestWebhookName(t *testing.T) {
+	if got, want := webhookName("bindings.example.com", admissionregistrationv1beta1.Fail), "fail.bindings.example.com"; got != want {
+		t.Errorf("webhookName(Fail) = %q, wanted %q", got, want)
+	}
+	if got, want := webhookName("bindings.example.com", admissionregistrationv1beta1.Ignore), "ignore.bindings.example.com"; got != want {
+		t.Errorf("webhookName(Ignore) = %q, wanted %q", got, want)
+	}
+}
+
+func TestProgrammed(t *testing.T) {
+	const name = "bindings.example.com"
+	entry := func(policy admissionregistrationv1beta1.FailurePolicyType, namespaces ...string) admissionregistrationv1beta1.MutatingWebhook {
+		return admissionregistrationv1beta1.MutatingWebhook{
+			Name: webhookName(name, policy),
+			Rules: []admissionregistrationv1beta1.RuleWithOperations{{
+				Rule: admissionregistrationv1beta1.Rule{
+					APIGroups:   []string{"apps"},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"deployments/*"},
+				},
+			}},
+			NamespaceSelector: namespaceSelector(podbinding.ExclusionSelector, namespaces),
+		}
+	}
+	mwh := &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Webhooks: []admissionregistrationv1beta1.MutatingWebhook{
+			{Name: "foreign.example.com"},
+			entry(admissionregistrationv1beta1.Fail, "critical", "mixed"),
+			entry(admissionregistrationv1beta1.Ignore, "relaxed"),
+		},
+	}
+	// The single entry programmed where namespaces aren't labeled.
+	fallback := func(policy admissionregistrationv1beta1.FailurePolicyType) *admissionregistrationv1beta1.MutatingWebhookConfiguration {
+		return &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Webhooks:   []admissionregistrationv1beta1.MutatingWebhook{entry(policy)},
+		}
+	}
+	policied := func(ref tracker.Reference, policy admissionregistrationv1beta1.FailurePolicyType) podbinding.Bindable {
+		return &policiedBindable{bindable: bindable{subject: ref}, policy: policy}
+	}
+
+	tests := []struct {
+		name      string
+		mwh       *admissionregistrationv1beta1.MutatingWebhookConfiguration
+		unlabeled bool
+		fb        podbinding.Bindable
+		wantErr   bool
+	}{{
+		name: "critical",
+		fb:   &bindable{subject: subject("apps/v1", "Deployment", "critical")},
+	}, {
+		name:      "namespaces selected by name, but unlabeled",
+		unlabeled: true,
+		fb:        &bindable{subject: subject("apps/v1", "Deployment", "critical")},
+		wantErr:   true,
+	}, {
+		name:      "unlabeled fallback",
+		mwh:       fallback(admissionregistrationv1beta1.Fail),
+		unlabeled: true,
+		fb:        &bindable{subject: subject("apps/v1", "Deployment", "default")},
+	}, {
+		name:      "unlabeled fallback failing open",
+		mwh:       fallback(admissionregistrationv1beta1.Ignore),
+		unlabeled: true,
+		fb:        &bindable{subject: subject("apps/v1", "Deployment", "default")},
+		wantErr:   true,
+	}, {
+		name:      "relaxed in the unlabeled fallback",
+		mwh:       fallback(admissionregistrationv1beta1.Ignore),
+		unlabeled: true,
+		fb:        policied(subject("apps/v1", "Deployment", "default"), admissionregistrationv1beta1.Ignore),
+	}, {
+		name: "relaxed",
+		fb:   policied(subject("apps/v1", "Deployment", "relaxed"), admissionregistrationv1beta1.Ignore),
+	}, {
+		name: "relaxed in a critical namespace",
+		fb:   policied(subject("apps/v1", "Deployment", "mixed"), admissionregistrationv1beta1.Ignore),
+	}, {
+		name:    "critical in a relaxed namespace",
+		fb:      policied(subject("apps/v1", "Deployment", "relaxed"), admissionregistrationv1beta1.Fail),
+		wantErr: true,
+	}, {
+		name:    "namespace not selected",
+		fb:      &bindable{subject: subject("apps/v1", "Deployment", "default")},
+		wantErr: true,
+	}, {
+		name:    "kind not intercepted",
+		fb:      &bindable{subject: subject("batch/v1", "Job", "critical")},
+		wantErr: true,
+	}, {
+		name:    "malformed apiVersion",
+		fb:      &bindable{subject: subject("a/b/c", "Foo", "critical")},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := mwh
+			if test.mwh != nil {
+				m = test.mwh
+			}
+			if err := Programmed(m, test.fb, !test.unlabeled); (err != nil) != test.wantErr {
+				t.Errorf("Programmed() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
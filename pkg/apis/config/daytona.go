@@ -0,0 +1,275 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/dgerd/daytona-binding/pkg/registry"
+)
+
+const (
+	// DaytonaConfigName is the name of the ConfigMap holding the policy
+	// applied to the Daytona containers we inject.
+	DaytonaConfigName = "config-daytona"
+
+	allowedImagesKey    = "allowed-images"
+	requireDigestKey    = "require-digest"
+	resolveImageTagsKey = "resolve-image-tags"
+	rolloutIntervalKey  = "rollout-interval"
+	rolloutDeadlineKey  = "rollout-deadline"
+	vaultAddressKey     = "vault-address"
+	secretPollKey       = "secret-poll-interval"
+	preflightRoleKey    = "preflight-role"
+	preflightMountKey   = "preflight-auth-mount"
+	noSubjectsPeriodKey = "no-subjects-period"
+	renewerImageKey     = "renewer-image"
+
+	// DefaultPreflightAuthMount is the default path of the kubernetes auth
+	// method the controller logs in to Vault with.
+	DefaultPreflightAuthMount = "kubernetes"
+
+	// DefaultRolloutInterval is the default minimum time between two
+	// restarts of the same workload.
+	DefaultRolloutInterval = 5 * time.Minute
+
+	// DefaultRolloutDeadline is the default time a restarted workload has
+	// to replace its stale subjects.
+	DefaultRolloutDeadline = 15 * time.Minute
+
+	// DefaultSecretPollInterval is the default time between two checks of
+	// the version of a binding's Vault secrets.
+	DefaultSecretPollInterval = time.Minute
+
+	// DefaultNoSubjectsPeriod is the default time a binding may resolve to
+	// no subjects before it warns about it.
+	DefaultNoSubjectsPeriod = 5 * time.Minute
+)
+
+// Daytona holds the policy applied to the Daytona image of every binding.
+type Daytona struct {
+	// AllowedImages is the list of registries (e.g. "gcr.io") and
+	// repository prefixes (e.g. "gcr.io/my-project/daytona") from which
+	// the Daytona image may be pulled.  An empty list allows any image.
+	AllowedImages []string
+
+	// RequireDigest requires the Daytona image to be pinned by digest.
+	RequireDigest bool
+
+	// ResolveImageTags has the reconciler resolve tagged Daytona images to
+	// a digest, which is then injected in place of the tag.
+	ResolveImageTags bool
+
+	// RolloutInterval is the minimum time between two restarts of the same
+	// workload by a binding with the RestartOwners rollout policy.
+	RolloutInterval time.Duration
+
+	// RolloutDeadline is the time a restarted workload has to replace its
+	// stale subjects. Past it, the workload is reported as stuck and no
+	// longer counts against the binding's maxConcurrentRollouts.
+	RolloutDeadline time.Duration
+
+	// VaultAddress is the address of the Vault server holding the secrets
+	// daytona injects. When set, the controller polls the version of each
+	// binding's KV v2 secrets, so that rotating them marks the subjects
+	// injected with the prior version as stale.
+	VaultAddress string
+
+	// SecretPollInterval is the time between two checks of the version of
+	// a binding's secrets.
+	SecretPollInterval time.Duration
+
+	// PreflightRole is the Vault role of the kubernetes auth method mounted
+	// at PreflightAuthMount that the controller logs in with to verify the
+	// Vault configuration of each binding. Preflight checks are only run
+	// when both it and VaultAddress are set.
+	PreflightRole string
+
+	// PreflightAuthMount is the path of the kubernetes auth method the
+	// controller logs in with.
+	PreflightAuthMount string
+
+	// NoSubjectsPeriod is the time a binding may resolve to no subjects
+	// before its NoSubjects condition turns True.
+	NoSubjectsPeriod time.Duration
+
+	// RenewerImage is the image installing the renewer binary that the
+	// renewal sidecar of a binding runs daytona with. Bindings asking for
+	// renewal are denied admission of their subjects when it isn't set.
+	RenewerImage string
+}
+
+func defaultDaytona() *Daytona {
+	return &Daytona{
+		RolloutInterval:    DefaultRolloutInterval,
+		RolloutDeadline:    DefaultRolloutDeadline,
+		SecretPollInterval: DefaultSecretPollInterval,
+		PreflightAuthMount: DefaultPreflightAuthMount,
+		NoSubjectsPeriod:   DefaultNoSubjectsPeriod,
+	}
+}
+
+// NewDaytonaFromConfigMap creates a Daytona config from the supplied ConfigMap.
+func NewDaytonaFromConfigMap(cm *corev1.ConfigMap) (*Daytona, error) {
+	d := defaultDaytona()
+
+	if raw, ok := cm.Data[allowedImagesKey]; ok {
+		for _, entry := range strings.FieldsFunc(raw, func(r rune) bool {
+			return r == ',' || r == '\n' || r == ' '
+		}) {
+			d.AllowedImages = append(d.AllowedImages, normalizeImagePrefix(entry))
+		}
+	}
+
+	for key, field := range map[string]*bool{
+		requireDigestKey:    &d.RequireDigest,
+		resolveImageTagsKey: &d.ResolveImageTags,
+	} {
+		if raw, ok := cm.Data[key]; ok {
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %q: %w", key, err)
+			}
+			*field = b
+		}
+	}
+
+	if raw, ok := cm.Data[rolloutIntervalKey]; ok {
+		i, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", rolloutIntervalKey, err)
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("%q must not be negative, was %v", rolloutIntervalKey, i)
+		}
+		d.RolloutInterval = i
+	}
+
+	if raw, ok := cm.Data[rolloutDeadlineKey]; ok {
+		dl, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", rolloutDeadlineKey, err)
+		}
+		if dl <= 0 {
+			return nil, fmt.Errorf("%q must be positive, was %v", rolloutDeadlineKey, dl)
+		}
+		d.RolloutDeadline = dl
+	}
+
+	if raw, ok := cm.Data[vaultAddressKey]; ok && raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q must be an http(s) URL, was %q", vaultAddressKey, raw)
+		}
+		d.VaultAddress = raw
+	}
+
+	if raw, ok := cm.Data[secretPollKey]; ok {
+		i, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", secretPollKey, err)
+		}
+		if i < time.Second {
+			return nil, fmt.Errorf("%q must be at least 1s, was %v", secretPollKey, i)
+		}
+		d.SecretPollInterval = i
+	}
+
+	if raw, ok := cm.Data[noSubjectsPeriodKey]; ok {
+		i, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", noSubjectsPeriodKey, err)
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("%q must not be negative, was %v", noSubjectsPeriodKey, i)
+		}
+		d.NoSubjectsPeriod = i
+	}
+
+	d.PreflightRole = cm.Data[preflightRoleKey]
+	d.RenewerImage = strings.TrimSpace(cm.Data[renewerImageKey])
+	if raw := strings.Trim(cm.Data[preflightMountKey], "/"); raw != "" {
+		d.PreflightAuthMount = raw
+	}
+	return d, nil
+}
+
+// CheckImage returns an error describing why the provided image reference
+// is not permitted by the policy, or nil when it is.
+func (d *Daytona) CheckImage(image string) error {
+	ref, err := d.checkRepository(image)
+	if err != nil {
+		return err
+	}
+	if d.RequireDigest && !ref.HasDigest() {
+		return fmt.Errorf("image %q must be pinned by digest", image)
+	}
+	return nil
+}
+
+// CheckSpecImage is like CheckImage, but for the image as written in a
+// binding's spec, which may be a tag when the reconciler resolves tags
+// to digests on our behalf.
+func (d *Daytona) CheckSpecImage(image string) error {
+	if d.ResolveImageTags {
+		_, err := d.checkRepository(image)
+		return err
+	}
+	return d.CheckImage(image)
+}
+
+func (d *Daytona) checkRepository(image string) (registry.Reference, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return ref, err
+	}
+	if !d.isAllowed(ref) {
+		return ref, fmt.Errorf("image %q is not in the allowed registries or repositories %v", image, d.AllowedImages)
+	}
+	return ref, nil
+}
+
+func (d *Daytona) isAllowed(ref registry.Reference) bool {
+	if len(d.AllowedImages) == 0 {
+		return true
+	}
+	name := ref.Name()
+	for _, prefix := range d.AllowedImages {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeImagePrefix maps the user-facing Docker Hub aliases onto the
+// registry name produced by registry.ParseReference.
+func normalizeImagePrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	for _, alias := range []string{"docker.io", "registry-1.docker.io"} {
+		if prefix == alias || strings.HasPrefix(prefix, alias+"/") {
+			return registry.DefaultRegistry + strings.TrimPrefix(prefix, alias)
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewDaytonaFromConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    *Daytona
+		wantErr bool
+	}{{
+		name: "empty",
+		data: map[string]string{},
+		want: &Daytona{
+			RolloutInterval:    DefaultRolloutInterval,
+			RolloutDeadline:    DefaultRolloutDeadline,
+			SecretPollInterval: DefaultSecretPollInterval,
+			PreflightAuthMount: DefaultPreflightAuthMount,
+			NoSubjectsPeriod:   DefaultNoSubjectsPeriod,
+		},
+	}, {
+		name: "allowlist and digest",
+		data: map[string]string{
+			allowedImagesKey:    "gcr.io/dangerd-dev/,\ndocker.io/cruise",
+			requireDigestKey:    "true",
+			resolveImageTagsKey: "true",
+			rolloutIntervalKey:  "30s",
+			rolloutDeadlineKey:  "1h",
+			vaultAddressKey:     "https://vault.example.com:8200",
+			secretPollKey:       "5m",
+			preflightRoleKey:    "daytona-controller",
+			preflightMountKey:   "/kubernetes-prod/",
+			noSubjectsPeriodKey: "1h",
+			renewerImageKey:     "gcr.io/dangerd-dev/renewer@sha256:abc",
+		},
+		want: &Daytona{
+			AllowedImages:      []string{"gcr.io/dangerd-dev", "index.docker.io/cruise"},
+			RequireDigest:      true,
+			ResolveImageTags:   true,
+			RolloutInterval:    30 * time.Second,
+			RolloutDeadline:    time.Hour,
+			VaultAddress:       "https://vault.example.com:8200",
+			SecretPollInterval: 5 * time.Minute,
+			PreflightRole:      "daytona-controller",
+			PreflightAuthMount: "kubernetes-prod",
+			NoSubjectsPeriod:   time.Hour,
+			RenewerImage:       "gcr.io/dangerd-dev/renewer@sha256:abc",
+		},
+	}, {
+		name: "bad bool",
+		data: map[string]string{
+			requireDigestKey: "sure",
+		},
+		wantErr: true,
+	}, {
+		name: "negative rollout interval",
+		data: map[string]string{
+			rolloutIntervalKey: "-1m",
+		},
+		wantErr: true,
+	}, {
+		name: "zero rollout deadline",
+		data: map[string]string{
+			rolloutDeadlineKey: "0s",
+		},
+		wantErr: true,
+	}, {
+		name: "bad vault address",
+		data: map[string]string{
+			vaultAddressKey: "vault.example.com",
+		},
+		wantErr: true,
+	}, {
+		name: "poll too often",
+		data: map[string]string{
+			secretPollKey: "10ms",
+		},
+		wantErr: true,
+	}, {
+		name: "negative no subjects period",
+		data: map[string]string{
+			noSubjectsPeriodKey: "-5m",
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewDaytonaFromConfigMap(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: DaytonaConfigName},
+				Data:       test.data,
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewDaytonaFromConfigMap() = %v, wantErr %v", err, test.wantErr)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("NewDaytonaFromConfigMap() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	const digest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	d := &Daytona{
+		AllowedImages: []string{"gcr.io/dangerd-dev", "index.docker.io/cruise/daytona"},
+	}
+	tests := []struct {
+		image   string
+		digest  bool
+		wantErr bool
+	}{{
+		image: "gcr.io/dangerd-dev/daytona",
+	}, {
+		image: "cruise/daytona:1.2",
+	}, {
+		image:   "gcr.io/dangerd-dev-evil/daytona",
+		wantErr: true,
+	}, {
+		image:   "cruise/daytona-evil",
+		wantErr: true,
+	}, {
+		image:   "gcr.io/dangerd-dev/daytona:1.2",
+		digest:  true,
+		wantErr: true,
+	}, {
+		image:  "gcr.io/dangerd-dev/daytona@" + digest,
+		digest: true,
+	}}
+
+	for _, test := range tests {
+		d.RequireDigest = test.digest
+		if err := d.CheckImage(test.image); (err != nil) != test.wantErr {
+			t.Errorf("CheckImage(%q) = %v, wantErr %v", test.image, err, test.wantErr)
+		}
+	}
+
+	// Tags are fine in a spec when the reconciler will resolve them.
+	d.RequireDigest, d.ResolveImageTags = true, true
+	if err := d.CheckSpecImage("gcr.io/dangerd-dev/daytona:1.2"); err != nil {
+		t.Errorf("CheckSpecImage() = %v", err)
+	}
+	if err := d.CheckImage("gcr.io/dangerd-dev/daytona:1.2"); err == nil {
+		t.Error("CheckImage() = nil, wanted digest error")
+	}
+}
@@ -18,6 +18,24 @@ package v1alpha1
 
 import (
 	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/ptr"
+)
+
+const (
+	// DefaultRenewalInterval is the default time between two rewrites of
+	// the secrets by the renewer.
+	DefaultRenewalInterval = 5 * time.Minute
+
+	// DefaultRenewalFailureThreshold is the default number of consecutive
+	// failed rewrites after which the renewer is no longer Ready.
+	DefaultRenewalFailureThreshold = 3
+
+	// DefaultRenewalCommand is the default command running daytona in its
+	// image.
+	DefaultRenewalCommand = "daytona"
 )
 
 // SetDefaults implements apis.Defaultable
@@ -26,4 +44,42 @@ func (db *DaytonaBinding) SetDefaults(ctx context.Context) {
 		// Default the subject's namespace to our namespace.
 		db.Spec.Subject.Namespace = db.Namespace
 	}
+	if as := db.Spec.AuditSink; as != nil && as.Ref != nil && as.Ref.Namespace == "" {
+		// Default the audit sink's namespace to our namespace.
+		as.Ref.Namespace = db.Namespace
+	}
+	if sf := db.Spec.SecretFiles; sf != nil && sf.Mode == "" {
+		sf.Mode = SecretFilesModeOwner
+	}
+	if db.Spec.Enforcement == "" {
+		db.Spec.Enforcement = EnforcementEnforce
+	}
+	if db.Spec.FailurePolicy == "" {
+		db.Spec.FailurePolicy = FailurePolicyFail
+	}
+	if db.Spec.RolloutPolicy == "" {
+		db.Spec.RolloutPolicy = RolloutPolicyManual
+	}
+	if db.Spec.RolloutPolicy == RolloutPolicyRestartOwners && db.Spec.MaxConcurrentRollouts == nil {
+		db.Spec.MaxConcurrentRollouts = ptr.Int32(1)
+	}
+	if rs := db.Spec.Renewal; rs != nil {
+		rs.SetDefaults(ctx)
+	}
+}
+
+// SetDefaults implements apis.Defaultable
+func (rs *RenewalSpec) SetDefaults(ctx context.Context) {
+	if rs.Interval == nil {
+		rs.Interval = &metav1.Duration{Duration: DefaultRenewalInterval}
+	}
+	if rs.FailureThreshold == nil {
+		rs.FailureThreshold = ptr.Int32(DefaultRenewalFailureThreshold)
+	}
+	if len(rs.Command) == 0 {
+		rs.Command = []string{DefaultRenewalCommand}
+	}
+	if hp := rs.Reload; hp != nil && hp.HTTPPost != nil && hp.HTTPPost.Path == "" {
+		hp.HTTPPost.Path = "/"
+	}
 }
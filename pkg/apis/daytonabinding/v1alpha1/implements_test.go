@@ -21,6 +21,19 @@ import (
 
 	"knative.dev/pkg/apis/duck"
 	duckv1alpha1 "knative.dev/pkg/apis/duck/v1alpha1"
+
+	"github.com/dgerd/daytona-binding/pkg/admission"
+	"github.com/dgerd/daytona-binding/pkg/audit"
+)
+
+var (
+	// Check that DaytonaBinding declares whether it is critical, and
+	// whether it is only trying things out.
+	_ admission.FailurePolicied = (*DaytonaBinding)(nil)
+	_ admission.DryRunner       = (*DaytonaBinding)(nil)
+
+	// Check that the admission decisions about the subjects are audited.
+	_ audit.Auditable = (*DaytonaBinding)(nil)
 )
 
 func TestImplementsPodScalable(t *testing.T) {
@@ -17,25 +17,123 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"knative.dev/pkg/ptr"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"knative.dev/pkg/apis"
 	"knative.dev/pkg/apis/duck"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/ptr"
 	"knative.dev/pkg/tracker"
 
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
 	"github.com/dgerd/daytona-binding/pkg/daytona"
+	"github.com/dgerd/daytona-binding/pkg/decision"
+	"github.com/dgerd/daytona-binding/pkg/registry"
 )
 
 const (
-	// DaytonaBindingConditionReady is set when the binding has been applied to the subjects.
+	// DaytonaBindingConditionReady is set when the binding has been applied
+	// to the subjects. It aggregates the conditions that follow, up to
+	// SubjectsHealthy.
 	DaytonaBindingConditionReady = apis.ConditionReady
+
+	// DaytonaBindingConditionSpecValid is set when the spec passes
+	// validation. Its reason is InvalidSpec when it doesn't.
+	DaytonaBindingConditionSpecValid apis.ConditionType = "SpecValid"
+
+	// DaytonaBindingConditionSubjectResolved is set when the subject
+	// reference was resolved, and the binding applied to the subjects. Its
+	// reason is SubjectMissing when the named subject doesn't exist,
+	// BindingFailed when it couldn't be updated, and
+	// SubjectResolutionFailed otherwise.
+	DaytonaBindingConditionSubjectResolved apis.ConditionType = "SubjectResolved"
+
+	// DaytonaBindingConditionProfileResolved is set when what the binding
+	// injects, down to the digest of its image when tag resolution is
+	// enabled, was resolved. Its reason is ImageResolutionFailed when it
+	// wasn't.
+	DaytonaBindingConditionProfileResolved apis.ConditionType = "ProfileResolved"
+
+	// DaytonaBindingConditionPolicyAllowed is set when the image the binding
+	// injects is permitted by the policy of the config-daytona ConfigMap.
+	// Its reason is ImageNotAllowed when it isn't, in which case the
+	// admission of its subjects is denied.
+	DaytonaBindingConditionPolicyAllowed apis.ConditionType = "PolicyAllowed"
+
+	// DaytonaBindingConditionWebhookProgrammed is set when the webhook
+	// intercepts the subjects of the binding. Its reason is
+	// WebhookNotProgrammed when it doesn't, or not as the binding's
+	// failurePolicy requires, and WebhookUnavailable when the webhook's
+	// configuration can't be read.
+	DaytonaBindingConditionWebhookProgrammed apis.ConditionType = "WebhookProgrammed"
+
+	// DaytonaBindingConditionSubjectsUpToDate is set when every subject runs
+	// with the binding's current injected configuration. It is informational
+	// and does not affect Ready.
+	DaytonaBindingConditionSubjectsUpToDate apis.ConditionType = "SubjectsUpToDate"
+
+	// DaytonaBindingConditionRolloutsProgressing is set for bindings with
+	// the RestartOwners rollout policy. Its reason is RolloutStuck when a
+	// restarted workload didn't replace its stale subjects within the
+	// rollout-deadline of the config-daytona ConfigMap. It is informational
+	// and does not affect Ready.
+	DaytonaBindingConditionRolloutsProgressing apis.ConditionType = "RolloutsProgressing"
+
+	// DaytonaBindingConditionSubjectsHealthy is set when the daytona
+	// container of none of the subjects is failing to deliver the secrets.
+	// Its reason is DaytonaFailed when some are.
+	DaytonaBindingConditionSubjectsHealthy apis.ConditionType = "SubjectsHealthy"
+
+	// DaytonaBindingConditionVaultConfigVerified is set when the controller
+	// verified that Vault knows of the binding's auth mount and role, and
+	// that the role may read the binding's secrets. It is informational and
+	// does not affect Ready.
+	DaytonaBindingConditionVaultConfigVerified apis.ConditionType = "VaultConfigVerified"
+
+	// DaytonaBindingConditionSuspended is True while spec.suspend is set. It
+	// is informational and does not affect Ready.
+	DaytonaBindingConditionSuspended apis.ConditionType = "Suspended"
+
+	// DaytonaBindingConditionAuditSinkResolved is set when the controller
+	// resolved spec.auditSink. It is informational and does not affect
+	// Ready.
+	DaytonaBindingConditionAuditSinkResolved apis.ConditionType = "AuditSinkResolved"
+
+	// DaytonaBindingConditionNoSubjects is a warning set while the binding
+	// resolves to no subjects. It turns True once this has lasted for the
+	// no-subjects-period of the config-daytona ConfigMap, and does not
+	// affect Ready.
+	DaytonaBindingConditionNoSubjects apis.ConditionType = "NoSubjects"
 )
 
-var daytonaCondSet = apis.NewLivingConditionSet()
+// MaxSubjectNames caps the number of names reported in a SubjectList.
+const MaxSubjectNames = 20
+
+var daytonaCondSet = apis.NewLivingConditionSet(
+	DaytonaBindingConditionSpecValid,
+	DaytonaBindingConditionSubjectResolved,
+	DaytonaBindingConditionProfileResolved,
+	DaytonaBindingConditionPolicyAllowed,
+	DaytonaBindingConditionWebhookProgrammed,
+	DaytonaBindingConditionSubjectsHealthy,
+)
+
+// seccompAnnotation returns the annotation selecting the seccomp profile of
+// the named container.
+func seccompAnnotation(container string) string {
+	return corev1.SeccompContainerAnnotationKeyPrefix + container
+}
 
 // GetGroupVersionKind implements kmeta.OwnerRefable
 func (db *DaytonaBinding) GetGroupVersionKind() schema.GroupVersionKind {
@@ -47,6 +145,30 @@ func (db *DaytonaBinding) GetSubject() tracker.Reference {
 	return db.Spec.Subject
 }
 
+// IsDryRun implements admission.DryRunner
+func (db *DaytonaBinding) IsDryRun() bool {
+	return db.Spec.Enforcement == EnforcementDryRun
+}
+
+// GetFailurePolicy implements admission.FailurePolicied
+func (db *DaytonaBinding) GetFailurePolicy() admissionregistrationv1beta1.FailurePolicyType {
+	// Trying a binding out must never keep its subjects from running.
+	if db.Spec.FailurePolicy == FailurePolicyIgnore || db.IsDryRun() {
+		return admissionregistrationv1beta1.Ignore
+	}
+	return admissionregistrationv1beta1.Fail
+}
+
+// AuditSink implements audit.Auditable
+func (db *DaytonaBinding) AuditSink() *apis.URL {
+	return db.Status.AuditSinkURI
+}
+
+// AuditVault implements audit.Auditable
+func (db *DaytonaBinding) AuditVault() (string, []string) {
+	return db.Spec.VaultAuthRole, db.SecretPaths()
+}
+
 // GetBindingStatus implements Bindable
 func (db *DaytonaBinding) GetBindingStatus() duck.BindableStatus {
 	return &db.Status
@@ -62,19 +184,292 @@ func (dbs *DaytonaBindingStatus) InitializeConditions() {
 	daytonaCondSet.Manage(dbs).InitializeConditions()
 }
 
-// MarkBindingUnavailable marks when the DaytonaBinding CRD is not Ready with a reason.
+// MarkBindingUnavailable implements BindableStatus, marking why the subject
+// couldn't be resolved or bound.
 func (dbs *DaytonaBindingStatus) MarkBindingUnavailable(reason, message string) {
 	daytonaCondSet.Manage(dbs).MarkFalse(
-		DaytonaBindingConditionReady, reason, message)
+		DaytonaBindingConditionSubjectResolved, reason, "%s", message)
 }
 
-// MarkBindingAvailable marks when the DaytonaBinding CRD is Ready.
+// MarkBindingAvailable implements BindableStatus, marking the subject as
+// resolved and bound.
 func (dbs *DaytonaBindingStatus) MarkBindingAvailable() {
-	daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionReady)
+	daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionSubjectResolved)
+}
+
+// MarkSpecValid marks the binding's spec as valid.
+func (dbs *DaytonaBindingStatus) MarkSpecValid() {
+	daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionSpecValid)
+}
+
+// MarkSpecInvalid marks the binding's spec as failing validation, which
+// objects stored before the validation was tightened may.
+func (dbs *DaytonaBindingStatus) MarkSpecInvalid(err *apis.FieldError) {
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionSpecValid, "InvalidSpec", "%v", err)
+}
+
+// MarkProfileResolved marks what the binding injects as resolved.
+func (dbs *DaytonaBindingStatus) MarkProfileResolved() {
+	daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionProfileResolved)
+}
+
+// MarkProfileUnresolved marks why what the binding injects couldn't be
+// resolved.
+func (dbs *DaytonaBindingStatus) MarkProfileUnresolved(reason, messageFormat string, messageA ...interface{}) {
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionProfileResolved, reason, messageFormat, messageA...)
+}
+
+// MarkPolicyAllowed marks the image the binding injects as permitted.
+func (dbs *DaytonaBindingStatus) MarkPolicyAllowed() {
+	daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionPolicyAllowed)
+}
+
+// MarkPolicyDenied marks why the image the binding injects isn't permitted.
+func (dbs *DaytonaBindingStatus) MarkPolicyDenied(err error) {
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionPolicyAllowed, "ImageNotAllowed", "%v", err)
+}
+
+// MarkWebhookProgrammed marks the webhook as intercepting the subjects.
+func (dbs *DaytonaBindingStatus) MarkWebhookProgrammed() {
+	daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionWebhookProgrammed)
+}
+
+// MarkWebhookNotProgrammed marks why the webhook doesn't intercept the
+// subjects as it should.
+func (dbs *DaytonaBindingStatus) MarkWebhookNotProgrammed(reason, messageFormat string, messageA ...interface{}) {
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionWebhookProgrammed, reason, messageFormat, messageA...)
+}
+
+// MarkStaleSubjects records the names of the subjects running with an outdated
+// injected configuration, marking SubjectsUpToDate accordingly.
+func (dbs *DaytonaBindingStatus) MarkStaleSubjects(names []string) {
+	if len(names) == 0 {
+		dbs.StaleSubjects = nil
+		daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+			Type:     DaytonaBindingConditionSubjectsUpToDate,
+			Status:   corev1.ConditionTrue,
+			Severity: apis.ConditionSeverityInfo,
+		})
+		return
+	}
+	dbs.StaleSubjects = newSubjectList(names)
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionSubjectsUpToDate, "StaleSubjects",
+		"%d subject(s) run an outdated configuration and must be recreated", len(names))
+}
+
+// MarkRolloutsProgressing marks the rollouts of the binding as progressing.
+func (dbs *DaytonaBindingStatus) MarkRolloutsProgressing() {
+	daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+		Type:     DaytonaBindingConditionRolloutsProgressing,
+		Status:   corev1.ConditionTrue,
+		Severity: apis.ConditionSeverityInfo,
+	})
+}
+
+// MarkRolloutsStuck records the workloads that didn't replace their stale
+// subjects within the given deadline.
+func (dbs *DaytonaBindingStatus) MarkRolloutsStuck(workloads []string, deadline time.Duration) {
+	daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+		Type:     DaytonaBindingConditionRolloutsProgressing,
+		Status:   corev1.ConditionFalse,
+		Severity: apis.ConditionSeverityInfo,
+		Reason:   "RolloutStuck",
+		Message: fmt.Sprintf("%s did not replace their stale subjects within %v of being restarted",
+			strings.Join(workloads, ", "), deadline),
+	})
+}
+
+// ClearRolloutsProgressing removes the RolloutsProgressing condition, when
+// the binding doesn't restart workloads.
+func (dbs *DaytonaBindingStatus) ClearRolloutsProgressing() {
+	daytonaCondSet.Manage(dbs).ClearCondition(DaytonaBindingConditionRolloutsProgressing)
+}
+
+// MarkUnhealthySubjects records the subjects whose daytona container is
+// failing, keyed by name with a description of their last failure, marking
+// SubjectsHealthy accordingly.
+func (dbs *DaytonaBindingStatus) MarkUnhealthySubjects(failures map[string]string) {
+	if len(failures) == 0 {
+		dbs.UnhealthySubjects = nil
+		daytonaCondSet.Manage(dbs).MarkTrue(DaytonaBindingConditionSubjectsHealthy)
+		return
+	}
+	names := make([]string, 0, len(failures))
+	for name := range failures {
+		names = append(names, name)
+	}
+	dbs.UnhealthySubjects = newSubjectList(names)
+	first := dbs.UnhealthySubjects.Names[0]
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionSubjectsHealthy, "DaytonaFailed",
+		"daytona is failing in %d subject(s), e.g. %s: %s", len(failures), first, failures[first])
+}
+
+// MarkVaultConfigVerified marks the binding's Vault configuration as verified.
+func (dbs *DaytonaBindingStatus) MarkVaultConfigVerified() {
+	daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+		Type:     DaytonaBindingConditionVaultConfigVerified,
+		Status:   corev1.ConditionTrue,
+		Severity: apis.ConditionSeverityInfo,
+	})
+}
+
+// MarkVaultConfigUnverified marks why the binding's Vault configuration
+// failed verification.
+func (dbs *DaytonaBindingStatus) MarkVaultConfigUnverified(reason, messageFormat string, messageA ...interface{}) {
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionVaultConfigVerified, reason, messageFormat, messageA...)
+}
+
+// ClearVaultConfigVerified removes the VaultConfigVerified condition, when
+// the binding's Vault configuration isn't being verified.
+func (dbs *DaytonaBindingStatus) ClearVaultConfigVerified() {
+	daytonaCondSet.Manage(dbs).ClearCondition(DaytonaBindingConditionVaultConfigVerified)
+}
+
+// MarkSuspended marks the binding as suspended.
+func (dbs *DaytonaBindingStatus) MarkSuspended() {
+	daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+		Type:     DaytonaBindingConditionSuspended,
+		Status:   corev1.ConditionTrue,
+		Severity: apis.ConditionSeverityInfo,
+		Reason:   "Suspended",
+		Message:  "New subjects aren't injected and existing ones are left alone",
+	})
+}
+
+// ClearSuspended removes the Suspended condition, when the binding is
+// resumed.
+func (dbs *DaytonaBindingStatus) ClearSuspended() {
+	daytonaCondSet.Manage(dbs).ClearCondition(DaytonaBindingConditionSuspended)
+}
+
+// MarkAuditSink records the resolved URI of the binding's audit sink.
+func (dbs *DaytonaBindingStatus) MarkAuditSink(uri *apis.URL) {
+	dbs.AuditSinkURI = uri
+	daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+		Type:     DaytonaBindingConditionAuditSinkResolved,
+		Status:   corev1.ConditionTrue,
+		Severity: apis.ConditionSeverityInfo,
+	})
+}
+
+// MarkAuditSinkUnresolved marks why the binding's audit sink couldn't be
+// resolved, which stops the auditing of its subjects.
+func (dbs *DaytonaBindingStatus) MarkAuditSinkUnresolved(reason, messageFormat string, messageA ...interface{}) {
+	dbs.AuditSinkURI = nil
+	daytonaCondSet.Manage(dbs).MarkFalse(DaytonaBindingConditionAuditSinkResolved, reason, messageFormat, messageA...)
+}
+
+// ClearAuditSink removes the AuditSinkResolved condition, when the binding
+// has no audit sink.
+func (dbs *DaytonaBindingStatus) ClearAuditSink() {
+	dbs.AuditSinkURI = nil
+	daytonaCondSet.Manage(dbs).ClearCondition(DaytonaBindingConditionAuditSinkResolved)
+}
+
+// MarkMatchedSubjects records the names of the subjects the binding
+// resolves to, clearing NoSubjects when there are some.
+func (dbs *DaytonaBindingStatus) MarkMatchedSubjects(names []string) {
+	dbs.MatchedSubjects = newSubjectList(names)
+	if len(names) > 0 {
+		daytonaCondSet.Manage(dbs).ClearCondition(DaytonaBindingConditionNoSubjects)
+	}
+}
+
+// MarkNoSubjects marks that the binding resolves to no subjects. NoSubjects
+// is Unknown until this has lasted for period, and True from then on. It
+// returns how long is left until then.
+func (dbs *DaytonaBindingStatus) MarkNoSubjects(period time.Duration) time.Duration {
+	since := time.Now()
+	if c := dbs.GetCondition(DaytonaBindingConditionNoSubjects); c != nil {
+		if c.IsTrue() {
+			return 0
+		}
+		since = c.LastTransitionTime.Inner.Time
+	}
+	if left := time.Until(since.Add(period)); left > 0 {
+		daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+			Type:     DaytonaBindingConditionNoSubjects,
+			Status:   corev1.ConditionUnknown,
+			Severity: apis.ConditionSeverityWarning,
+			Reason:   "AwaitingSubjects",
+			Message:  "The subject matches nothing yet",
+		})
+		return left
+	}
+	daytonaCondSet.Manage(dbs).SetCondition(apis.Condition{
+		Type:     DaytonaBindingConditionNoSubjects,
+		Status:   corev1.ConditionTrue,
+		Severity: apis.ConditionSeverityWarning,
+		Reason:   "NoSubjects",
+		Message:  fmt.Sprintf("The subject has matched nothing for at least %v", period),
+	})
+	return 0
+}
+
+// newSubjectList returns a SubjectList of the provided names.
+func newSubjectList(names []string) *SubjectList {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	if len(sorted) > MaxSubjectNames {
+		sorted = sorted[:MaxSubjectNames]
+	}
+	return &SubjectList{
+		Count: int32(len(names)),
+		Names: sorted,
+	}
+}
+
+// GetImage returns the Daytona image to inject. This is the digest recorded in
+// status.resolvedImage when it was resolved from the current spec.image, and
+// spec.image otherwise.
+func (db *DaytonaBinding) GetImage() string {
+	if db.Status.ResolvedImage == "" {
+		return db.Spec.Image
+	}
+	spec, err := registry.ParseReference(db.Spec.Image)
+	if err != nil {
+		return db.Spec.Image
+	}
+	resolved, err := registry.ParseReference(db.Status.ResolvedImage)
+	if err != nil {
+		return db.Spec.Image
+	}
+	resolved.Digest = ""
+	if resolved != spec {
+		return db.Spec.Image
+	}
+	return db.Status.ResolvedImage
 }
 
 // Do implements the logic of injecting all of the Daytona content into the Pod.
 func (db *DaytonaBinding) Do(ctx context.Context, pod *duckv1.WithPodable) {
+	decision.Handled(ctx, db)
+
+	if db.IsDryRun() {
+		db.dryRun(ctx, pod)
+		return
+	}
+
+	// Re-check the image policy, as it may have been tightened since this
+	// binding was admitted. Leave the subject untouched when it is violated.
+	image := db.GetImage()
+	if err := config.FromContextOrDefaults(ctx).Daytona.CheckImage(image); err != nil {
+		decision.Deny(ctx, "DaytonaBinding %s/%s: %v", db.Namespace, db.Name, err)
+		return
+	}
+
+	// Refuse to clobber volumes and containers we did not inject.
+	user := userContainer(pod)
+	userMount := db.Spec.Volume.userVolumeMount()
+	if err := checkConflicts(pod, user, userMount); err != nil {
+		decision.Deny(ctx, "DaytonaBinding %s/%s cannot be applied: %v", db.Namespace, db.Name, err)
+		return
+	}
+	if err := db.Spec.Renewal.check(ctx, pod); err != nil {
+		decision.Deny(ctx, "DaytonaBinding %s/%s cannot be applied: %v", db.Namespace, db.Name, err)
+		return
+	}
+
 	// First undo so that we can just unconditionally append below.
 	db.Undo(ctx, pod)
 
@@ -82,101 +477,674 @@ func (db *DaytonaBinding) Do(ctx context.Context, pod *duckv1.WithPodable) {
 	volume := corev1.Volume{
 		Name: daytona.SecretVolumeName,
 		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{
-				Medium: daytona.Medium,
-			},
+			EmptyDir: db.Spec.Volume.emptyDir(),
 		},
 	}
 	pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
 
-
 	volumeMount := []corev1.VolumeMount{{
-		Name: daytona.SecretVolumeName,
+		Name:      daytona.SecretVolumeName,
 		MountPath: daytona.SecretMountPath,
 	}}
 	// Add daytona to the init containers section.
 	container := corev1.Container{
-		Name: daytona.ContainerName,
-		Env: daytonaEnv(db),
-		SecurityContext: &corev1.SecurityContext{
-			RunAsUser: ptr.Int64(daytona.RunAsUser),
-			AllowPrivilegeEscalation: ptr.Bool(false),
-		},
-		VolumeMounts: volumeMount,
-		Image: db.Spec.Image,
+		Name:            daytona.ContainerName,
+		Env:             daytonaEnv(db),
+		Resources:       db.Spec.Container.GetResources(),
+		ImagePullPolicy: db.Spec.Container.GetImagePullPolicy(),
+		SecurityContext: db.Spec.Container.GetSecurityContext(),
+		VolumeMounts:    volumeMount,
+		Image:           image,
 	}
 	pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
 
-	// Add volume mount to the user container. As users can customize the container name
-	// and sidecars can vary we look this up by the presence of the `K_REVISION` Environment
-	// Variable. This is a hack, but works.
-	for i, c := range pod.Spec.Containers {
-		for _, e := range c.Env {
-			// This container is the user container. Modify and then exit.
-			if e.Name == "K_REVISION" {
-				pod.Spec.Containers[i].VolumeMounts = append(pod.Spec.Containers[i].VolumeMounts, volumeMount[0])
-				return
-			}
-		}
+	// Pods have no seccomp field in the API versions we support, so use
+	// the annotation to run daytona with the runtime's default profile.
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string, 1)
+	}
+	pod.Annotations[seccompAnnotation(daytona.ContainerName)] = daytona.SeccompProfile
+
+	// Record that we injected into this Pod, so that we know what is ours,
+	// along with the provenance of what we injected.
+	pod.Annotations[daytona.InjectedAnnotation] = db.Namespace + "/" + db.Name
+	pod.Annotations[daytona.GenerationAnnotation] = strconv.FormatInt(db.Generation, 10)
+	pod.Annotations[daytona.ConfigHashAnnotation] = db.ConfigHash()
+	pod.Annotations[daytona.ImageAnnotation] = image
+
+	// Add volume mount to the user container.
+	if user >= 0 {
+		pod.Spec.Containers[user].VolumeMounts = append(pod.Spec.Containers[user].VolumeMounts, userMount)
+	}
+
+	// Make sure the user container can read what daytona writes.
+	pinned := db.Spec.Container != nil && db.Spec.Container.SecurityContext != nil &&
+		db.Spec.Container.SecurityContext.RunAsUser != nil
+	db.Spec.SecretFiles.apply(ctx, pod, &pod.Spec.InitContainers[len(pod.Spec.InitContainers)-1], user, pinned)
+
+	// Keep the secrets up to date while the subjects run.
+	if rs := db.Spec.Renewal; rs != nil {
+		rs.apply(ctx, pod, pod.Spec.InitContainers[len(pod.Spec.InitContainers)-1], db.Spec.TokenPath)
+	}
+
+	// Hold the Pod's readiness until daytona delivered the secrets.
+	if db.Spec.ReadinessGate {
+		pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{
+			ConditionType: daytona.SecretsReadyCondition,
+		})
+	}
+}
+
+// dryRun annotates the Pod with the injection Do would have made, including
+// why it would have rejected the Pod, without rejecting it.
+func (db *DaytonaBinding) dryRun(ctx context.Context, pod *duckv1.WithPodable) {
+	dr := daytona.DryRun{
+		Binding:     db.Namespace + "/" + db.Name,
+		Image:       db.GetImage(),
+		Role:        db.Spec.VaultAuthRole,
+		SecretPaths: db.SecretPaths(),
+	}
+	if err := config.FromContextOrDefaults(ctx).Daytona.CheckImage(dr.Image); err != nil {
+		dr.Denied = err.Error()
+	} else if err := checkConflicts(pod, userContainer(pod), db.Spec.Volume.userVolumeMount()); err != nil {
+		dr.Denied = err.Error()
+	} else if err := db.Spec.Renewal.check(ctx, pod); err != nil {
+		dr.Denied = err.Error()
+	}
+
+	b, err := json.Marshal(dr)
+	if err != nil {
+		// None of the above can fail to marshal.
+		panic(err)
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string, 1)
 	}
+	pod.Annotations[daytona.DryRunAnnotation] = string(b)
 }
 
 // Undo implements the logic of removing all of the Daytona content from the Pod.
 func (db *DaytonaBinding) Undo(ctx context.Context, pod *duckv1.WithPodable) {
+	decision.Handled(ctx, db)
 
-	// Remove Daytona Volume
-	for i, v := range pod.Spec.Volumes {
-		if v.Name == daytona.SecretVolumeName {
-			pod.Spec.Volumes = append(pod.Spec.Volumes[:i], pod.Spec.Volumes[i+1:]...)
-			break
+	delete(pod.Annotations, daytona.DryRunAnnotation)
+
+	// Leave alone volumes and containers that merely share our names, and
+	// those injected by another DaytonaBinding.
+	if !db.injected(pod) {
+		return
+	}
+	for _, a := range []string{
+		daytona.InjectedAnnotation,
+		daytona.GenerationAnnotation,
+		daytona.ConfigHashAnnotation,
+		daytona.ImageAnnotation,
+	} {
+		delete(pod.Annotations, a)
+	}
+
+	// Remove the seccomp annotations of the Daytona InitContainers and the
+	// renewer sidecar
+	for _, c := range []string{daytona.ContainerName, daytona.RenewerInstallContainerName, daytona.RenewerContainerName} {
+		delete(pod.Annotations, seccompAnnotation(c))
+	}
+
+	// Remove Daytona Volumes
+	pod.Spec.Volumes = removeVolumes(pod.Spec.Volumes, daytona.SecretVolumeName, daytona.RenewerVolumeName)
+
+	// Remove Daytona InitContainers and the renewer sidecar
+	pod.Spec.InitContainers = removeContainers(pod.Spec.InitContainers, daytona.ContainerName, daytona.RenewerInstallContainerName)
+	pod.Spec.Containers = removeContainers(pod.Spec.Containers, daytona.RenewerContainerName)
+
+	// Remove the environment variable marking the container to reload
+	for i, c := range pod.Spec.Containers {
+		for j, e := range c.Env {
+			if e.Name == daytona.ReloadTargetEnv {
+				pod.Spec.Containers[i].Env = append(c.Env[:j], c.Env[j+1:]...)
+				if len(pod.Spec.Containers[i].Env) == 0 {
+					pod.Spec.Containers[i].Env = nil
+				}
+				break
+			}
 		}
 	}
 
-	// Remove Daytona InitContainer
-	for i, c := range pod.Spec.InitContainers {
-		if c.Name == daytona.ContainerName {
-			pod.Spec.InitContainers = append(pod.Spec.InitContainers[:i], pod.Spec.InitContainers[i+1:]...)
+	// Stop sharing the process namespace, if we started to.
+	if _, ok := pod.Annotations[daytona.ShareProcessNamespaceAnnotation]; ok {
+		delete(pod.Annotations, daytona.ShareProcessNamespaceAnnotation)
+		pod.Spec.ShareProcessNamespace = nil
+	}
+
+	// Remove our readiness gate
+	for i, rg := range pod.Spec.ReadinessGates {
+		if rg.ConditionType == daytona.SecretsReadyCondition {
+			pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates[:i], pod.Spec.ReadinessGates[i+1:]...)
+			if len(pod.Spec.ReadinessGates) == 0 {
+				pod.Spec.ReadinessGates = nil
+			}
 			break
 		}
 	}
 
+	// Remove the fsGroup we set, if any.
+	if _, ok := pod.Annotations[daytona.FSGroupAnnotation]; ok {
+		delete(pod.Annotations, daytona.FSGroupAnnotation)
+		if sc := pod.Spec.SecurityContext; sc != nil {
+			sc.FSGroup = nil
+			if equality.Semantic.DeepEqual(sc, &corev1.PodSecurityContext{}) {
+				pod.Spec.SecurityContext = nil
+			}
+		}
+	}
+
 	// Remove Volume from user container
+	if user := userContainer(pod); user >= 0 {
+		c := pod.Spec.Containers[user]
+		for j, vm := range c.VolumeMounts {
+			if vm.Name == daytona.SecretVolumeName {
+				pod.Spec.Containers[user].VolumeMounts = append(c.VolumeMounts[:j], c.VolumeMounts[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// ConfigHash returns a hash of the effective configuration this binding
+// injects, which changes whenever a Pod injected with a prior configuration
+// would need to be recreated to pick up the current one. Rotations of the
+// secrets daytona reads are tracked by status.secretsRotatedAt instead.
+func (db *DaytonaBinding) ConfigHash() string {
+	b, err := json.Marshal(struct {
+		Image       string                       `json:"image"`
+		Env         []corev1.EnvVar              `json:"env"`
+		Resources   corev1.ResourceRequirements  `json:"resources"`
+		PullPolicy  corev1.PullPolicy            `json:"pullPolicy"`
+		Security    *corev1.SecurityContext      `json:"security"`
+		EmptyDir    *corev1.EmptyDirVolumeSource `json:"emptyDir"`
+		Mount       corev1.VolumeMount           `json:"mount"`
+		SecretFiles *SecretFilesSpec             `json:"secretFiles"`
+		Gate        bool                         `json:"readinessGate,omitempty"`
+		Renewal     *RenewalSpec                 `json:"renewal,omitempty"`
+	}{
+		Image:       db.GetImage(),
+		Env:         daytonaEnv(db),
+		Resources:   db.Spec.Container.GetResources(),
+		PullPolicy:  db.Spec.Container.GetImagePullPolicy(),
+		Security:    db.Spec.Container.GetSecurityContext(),
+		EmptyDir:    db.Spec.Volume.emptyDir(),
+		Mount:       db.Spec.Volume.userVolumeMount(),
+		SecretFiles: db.Spec.SecretFiles,
+		Gate:        db.Spec.ReadinessGate,
+		Renewal:     db.Spec.Renewal,
+	})
+	if err != nil {
+		// None of the above can fail to marshal.
+		panic(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// SecretPaths returns the Vault paths daytona reads the secrets from.
+func (db *DaytonaBinding) SecretPaths() []string {
+	var paths []string
+	for _, p := range []string{db.Spec.VaultSecretsApp, db.Spec.VaultSecretsGlobal} {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// isInjected returns whether the Daytona content of the Pod was injected by
+// a DaytonaBinding. Pods injected before we started to annotate them are
+// recognized by a daytona init container mounting the secrets volume.
+func isInjected(pod *duckv1.WithPodable) bool {
+	if _, ok := pod.Annotations[daytona.InjectedAnnotation]; ok {
+		return true
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name != daytona.ContainerName {
+			continue
+		}
+		for _, vm := range c.VolumeMounts {
+			if vm.Name == daytona.SecretVolumeName && vm.MountPath == daytona.SecretMountPath {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// injected returns whether the Daytona content of the Pod was injected by
+// this DaytonaBinding. Pods injected before we started to annotate them carry
+// no record of their binding and are attributed to whichever one undoes them.
+func (db *DaytonaBinding) injected(pod *duckv1.WithPodable) bool {
+	if by, ok := pod.Annotations[daytona.InjectedAnnotation]; ok {
+		return by == db.Namespace+"/"+db.Name
+	}
+	return isInjected(pod)
+}
+
+// checkConflicts returns an error describing the first volume, container or
+// mount path of the Pod that collides with what we inject, ignoring anything
+// we injected previously.
+func checkConflicts(pod *duckv1.WithPodable, user int, userMount corev1.VolumeMount) error {
+	if !isInjected(pod) {
+		for _, v := range pod.Spec.Volumes {
+			switch v.Name {
+			case daytona.SecretVolumeName, daytona.RenewerVolumeName:
+				return fmt.Errorf("the Pod already has a volume named %q", v.Name)
+			}
+		}
+		for _, cs := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+			for _, c := range cs {
+				switch c.Name {
+				case daytona.ContainerName, daytona.RenewerInstallContainerName, daytona.RenewerContainerName:
+					return fmt.Errorf("the Pod already has a container named %q", c.Name)
+				}
+			}
+		}
+	}
+	if user < 0 {
+		return nil
+	}
+	c := pod.Spec.Containers[user]
+	for _, vm := range c.VolumeMounts {
+		if vm.Name == daytona.SecretVolumeName {
+			continue
+		}
+		if vm.MountPath == userMount.MountPath {
+			return fmt.Errorf("mount path %q collides with volume %q of container %q", vm.MountPath, vm.Name, c.Name)
+		}
+	}
+	return nil
+}
+
+// removeVolumes returns the provided volumes without those of the provided
+// names.
+func removeVolumes(volumes []corev1.Volume, names ...string) []corev1.Volume {
+	for _, name := range names {
+		for i, v := range volumes {
+			if v.Name == name {
+				volumes = append(volumes[:i], volumes[i+1:]...)
+				break
+			}
+		}
+	}
+	return volumes
+}
+
+// removeContainers returns the provided containers without those of the
+// provided names.
+func removeContainers(containers []corev1.Container, names ...string) []corev1.Container {
+	for _, name := range names {
+		for i, c := range containers {
+			if c.Name == name {
+				containers = append(containers[:i], containers[i+1:]...)
+				break
+			}
+		}
+	}
+	return containers
+}
+
+// check returns an error describing why the renewer can't be added to the
+// Pod, or nil when it can or renewal is disabled.
+func (rs *RenewalSpec) check(ctx context.Context, pod *duckv1.WithPodable) error {
+	if rs == nil {
+		return nil
+	}
+	if config.FromContextOrDefaults(ctx).Daytona.RenewerImage == "" {
+		return fmt.Errorf("spec.renewal requires the renewer-image of the %s ConfigMap", config.DaytonaConfigName)
+	}
+	if rs.Reload != nil && !hasContainer(pod, rs.Reload.Container) {
+		return fmt.Errorf("the Pod has no container named %q to reload", rs.Reload.Container)
+	}
+	return nil
+}
+
+// hasContainer returns whether the Pod has a container of the provided name.
+func hasContainer(pod *duckv1.WithPodable, name string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply adds the renewer to the Pod: an init container installing the
+// renewer binary, and a sidecar in which it runs daytona as the provided
+// daytona init container does, at an interval. The Vault token daytona
+// writes to tokenPath, if any, changes on every run and doesn't tell whether
+// the secrets changed.
+func (rs *RenewalSpec) apply(ctx context.Context, pod *duckv1.WithPodable, dc corev1.Container, tokenPath string) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: daytona.RenewerVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	renewerMount := corev1.VolumeMount{
+		Name:      daytona.RenewerVolumeName,
+		MountPath: daytona.RenewerMountPath,
+	}
+
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{
+		Name:            daytona.RenewerInstallContainerName,
+		Image:           config.FromContextOrDefaults(ctx).Daytona.RenewerImage,
+		Args:            []string{"install", daytona.RenewerBinary},
+		Resources:       *dc.Resources.DeepCopy(),
+		SecurityContext: dc.SecurityContext.DeepCopy(),
+		VolumeMounts:    []corev1.VolumeMount{renewerMount},
+	})
+
+	command := []string{
+		daytona.RenewerBinary, "run",
+		"--interval=" + rs.GetInterval().String(),
+		"--failure-threshold=" + strconv.Itoa(int(rs.GetFailureThreshold())),
+		"--secrets-dir=" + daytona.SecretMountPath,
+		"--ready-file=" + daytona.RenewerReadyFile,
+	}
+	if tokenPath != "" {
+		command = append(command, "--ignore="+tokenPath)
+	}
+	if rl := rs.Reload; rl != nil {
+		if rl.Signal != "" {
+			command = append(command, "--reload-signal="+rl.Signal)
+			for i, c := range pod.Spec.Containers {
+				if c.Name == rl.Container {
+					pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, corev1.EnvVar{
+						Name:  daytona.ReloadTargetEnv,
+						Value: daytona.ReloadTargetEnv,
+					})
+				}
+			}
+		} else {
+			command = append(command, fmt.Sprintf("--reload-url=http://localhost:%d%s", rl.HTTPPost.Port, rl.HTTPPost.GetPath()))
+		}
+	}
+	command = append(append(command, "--"), rs.GetCommand()...)
+
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name:            daytona.RenewerContainerName,
+		Image:           dc.Image,
+		Command:         command,
+		Env:             append([]corev1.EnvVar(nil), dc.Env...),
+		Resources:       *dc.Resources.DeepCopy(),
+		ImagePullPolicy: dc.ImagePullPolicy,
+		SecurityContext: dc.SecurityContext.DeepCopy(),
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      daytona.SecretVolumeName,
+			MountPath: daytona.SecretMountPath,
+		}, renewerMount},
+		ReadinessProbe: &corev1.Probe{
+			Handler: corev1.Handler{
+				Exec: &corev1.ExecAction{
+					Command: []string{daytona.RenewerBinary, "ready", daytona.RenewerReadyFile},
+				},
+			},
+		},
+	})
+
+	// The renewer containers run with the restrictions of daytona's.
+	for _, c := range []string{daytona.RenewerInstallContainerName, daytona.RenewerContainerName} {
+		pod.Annotations[seccompAnnotation(c)] = daytona.SeccompProfile
+	}
+
+	if rs.ShareProcessNamespace && (pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace) {
+		pod.Spec.ShareProcessNamespace = ptr.Bool(true)
+		pod.Annotations[daytona.ShareProcessNamespaceAnnotation] = "true"
+	}
+}
+
+// GetInterval returns the time between two rewrites of the secrets.
+func (rs *RenewalSpec) GetInterval() time.Duration {
+	if rs.Interval == nil {
+		return DefaultRenewalInterval
+	}
+	return rs.Interval.Duration
+}
+
+// GetFailureThreshold returns the number of consecutive failed rewrites
+// after which the renewer is no longer Ready.
+func (rs *RenewalSpec) GetFailureThreshold() int32 {
+	if rs.FailureThreshold == nil {
+		return DefaultRenewalFailureThreshold
+	}
+	return *rs.FailureThreshold
+}
+
+// GetCommand returns the command running daytona in its image.
+func (rs *RenewalSpec) GetCommand() []string {
+	if len(rs.Command) == 0 {
+		return []string{DefaultRenewalCommand}
+	}
+	return rs.Command
+}
+
+// GetPath returns the path of the reload endpoint.
+func (hr *HTTPReload) GetPath() string {
+	if hr.Path == "" {
+		return "/"
+	}
+	return hr.Path
+}
+
+// emptyDir returns the source of the secrets volume.
+func (vs *VolumeSpec) emptyDir() *corev1.EmptyDirVolumeSource {
+	ed := &corev1.EmptyDirVolumeSource{
+		Medium: daytona.Medium,
+	}
+	if vs == nil {
+		return ed
+	}
+	if vs.Medium == VolumeMediumDisk {
+		ed.Medium = corev1.StorageMediumDefault
+	}
+	if vs.SizeLimit != nil {
+		sl := vs.SizeLimit.DeepCopy()
+		ed.SizeLimit = &sl
+	}
+	return ed
+}
+
+// userVolumeMount returns the mount of the secrets volume in the user container.
+func (vs *VolumeSpec) userVolumeMount() corev1.VolumeMount {
+	vm := corev1.VolumeMount{
+		Name:      daytona.SecretVolumeName,
+		MountPath: daytona.SecretMountPath,
+	}
+	if vs == nil {
+		return vm
+	}
+	if vs.MountPath != "" {
+		vm.MountPath = vs.MountPath
+	}
+	vm.SubPath = vs.SubPath
+	vm.ReadOnly = vs.ReadOnly
+	return vm
+}
+
+// userContainer returns the index of the user container, or -1 if there is
+// none. As users can customize the container name and sidecars can vary we
+// look this up by the presence of the `K_REVISION` Environment Variable.
+// This is a hack, but works.
+func userContainer(pod *duckv1.WithPodable) int {
 	for i, c := range pod.Spec.Containers {
-		for j, e := range c.Env {
-			// This container is the user container. Remove and then exit.
+		for _, e := range c.Env {
 			if e.Name == "K_REVISION" {
-				pod.Spec.Containers[i].VolumeMounts = append(pod.Spec.Containers[i].VolumeMounts[:j], pod.Spec.Containers[i].VolumeMounts[j+1:]...)
-				return
+				return i
 			}
 		}
 	}
+	return -1
+}
+
+// apply arranges for the secret files written by the provided daytona
+// container to be readable by the user container at index user, warning at
+// admission when that cannot be guaranteed. The UID of the daytona container
+// is left alone when pinned by spec.container.securityContext.runAsUser.
+func (sf *SecretFilesSpec) apply(ctx context.Context, pod *duckv1.WithPodable, dc *corev1.Container, user int, pinned bool) {
+	// The UID the user container runs as, when the pod spec tells us.
+	var uid *int64
+	if pod.Spec.SecurityContext != nil {
+		uid = pod.Spec.SecurityContext.RunAsUser
+	}
+	if user >= 0 {
+		if sc := pod.Spec.Containers[user].SecurityContext; sc != nil && sc.RunAsUser != nil {
+			uid = sc.RunAsUser
+		}
+	}
+
+	switch {
+	case sf == nil:
+		if uid != nil && *uid != 0 && *uid != *dc.SecurityContext.RunAsUser {
+			decision.Warn(ctx, "secret files are owned by UID %d and may not be readable by UID %d, consider setting spec.secretFiles",
+				*dc.SecurityContext.RunAsUser, *uid)
+		}
+
+	case sf.Mode == SecretFilesModeGroup:
+		var fsGroup *int64
+		if pod.Spec.SecurityContext != nil {
+			fsGroup = pod.Spec.SecurityContext.FSGroup
+		}
+		gid := sf.Owner
+		if gid == nil {
+			gid = fsGroup
+		}
+		if gid == nil {
+			gid = dc.SecurityContext.RunAsUser
+		}
+
+		if fsGroup == nil {
+			if pod.Spec.SecurityContext == nil {
+				pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+			}
+			pod.Spec.SecurityContext.FSGroup = ptr.Int64(*gid)
+			pod.Annotations[daytona.FSGroupAnnotation] = strconv.FormatInt(*gid, 10)
+		} else if *fsGroup != *gid {
+			decision.Warn(ctx, "pod fsGroup %d differs from secret files group %d, secret files may not be readable",
+				*fsGroup, *gid)
+		}
+		dc.SecurityContext.RunAsGroup = ptr.Int64(*gid)
+
+	default:
+		owner := sf.Owner
+		if owner == nil {
+			owner = uid
+		}
+		switch {
+		case pinned:
+			if owner != nil && *owner != 0 && *owner != *dc.SecurityContext.RunAsUser {
+				decision.Warn(ctx, "daytona runs as UID %d from spec.container.securityContext.runAsUser, secret files may not be readable by UID %d",
+					*dc.SecurityContext.RunAsUser, *owner)
+			}
+		case owner == nil:
+			decision.Warn(ctx, "cannot determine the UID of the user container, secret files are owned by UID %d and may not be readable",
+				*dc.SecurityContext.RunAsUser)
+		case uid != nil && *uid != 0 && *uid != *owner:
+			decision.Warn(ctx, "secret files are owned by UID %d and may not be readable by UID %d",
+				*owner, *uid)
+			dc.SecurityContext.RunAsUser = ptr.Int64(*owner)
+		case *owner != 0:
+			// A root user container can read anything, so only run daytona
+			// as a non-root owner.
+			dc.SecurityContext.RunAsUser = ptr.Int64(*owner)
+		}
+	}
+}
+
+// GetResources returns the resources of the daytona container: the default
+// requests and limits, with any overrides applied per resource.
+func (cs *ContainerSpec) GetResources() corev1.ResourceRequirements {
+	res := daytona.DefaultResources()
+	if cs == nil || cs.Resources == nil {
+		return res
+	}
+	for name, q := range cs.Resources.Requests {
+		res.Requests[name] = q
+	}
+	for name, q := range cs.Resources.Limits {
+		res.Limits[name] = q
+	}
+	return res
+}
+
+// GetImagePullPolicy returns the image pull policy of the daytona container.
+func (cs *ContainerSpec) GetImagePullPolicy() corev1.PullPolicy {
+	if cs == nil {
+		return ""
+	}
+	return cs.ImagePullPolicy
+}
+
+// GetSecurityContext returns the security context of the daytona container:
+// the default security context, with any overrides applied per field.
+func (cs *ContainerSpec) GetSecurityContext() *corev1.SecurityContext {
+	sc := daytona.DefaultSecurityContext()
+	if cs == nil || cs.SecurityContext == nil {
+		return sc
+	}
+	o := cs.SecurityContext.DeepCopy()
+	if o.Capabilities != nil {
+		sc.Capabilities = o.Capabilities
+	}
+	if o.Privileged != nil {
+		sc.Privileged = o.Privileged
+	}
+	if o.SELinuxOptions != nil {
+		sc.SELinuxOptions = o.SELinuxOptions
+	}
+	if o.WindowsOptions != nil {
+		sc.WindowsOptions = o.WindowsOptions
+	}
+	if o.RunAsUser != nil {
+		sc.RunAsUser = o.RunAsUser
+	}
+	if o.RunAsGroup != nil {
+		sc.RunAsGroup = o.RunAsGroup
+	}
+	if o.RunAsNonRoot != nil {
+		sc.RunAsNonRoot = o.RunAsNonRoot
+	}
+	if o.ReadOnlyRootFilesystem != nil {
+		sc.ReadOnlyRootFilesystem = o.ReadOnlyRootFilesystem
+	}
+	if o.AllowPrivilegeEscalation != nil {
+		sc.AllowPrivilegeEscalation = o.AllowPrivilegeEscalation
+	}
+	if o.ProcMount != nil {
+		sc.ProcMount = o.ProcMount
+	}
+	return sc
 }
 
 func daytonaEnv(db *DaytonaBinding) []corev1.EnvVar {
 	return []corev1.EnvVar{
 		{
-			Name: "K8S_AUTH",
+			Name:  "K8S_AUTH",
 			Value: db.Spec.Auth,
 		}, {
-			Name: "K8S_AUTH_MOUNT",
+			Name:  "K8S_AUTH_MOUNT",
 			Value: db.Spec.AuthMount,
 		}, {
-			Name: "SECRET_ENV",
+			Name:  "SECRET_ENV",
 			Value: db.Spec.SecretEnv,
 		}, {
-			Name: "TOKEN_PATH",
+			Name:  "TOKEN_PATH",
 			Value: db.Spec.TokenPath,
 		}, {
-			Name: "VAULT_AUTH_ROLE",
+			Name:  "VAULT_AUTH_ROLE",
 			Value: db.Spec.VaultAuthRole,
 		}, {
-			Name: "SECRET_PATH",
+			Name:  "SECRET_PATH",
 			Value: db.Spec.SecretPath,
 		}, {
-			Name: "VAULT_SECRETS_APP",
+			Name:  "VAULT_SECRETS_APP",
 			Value: db.Spec.VaultSecretsApp,
 		}, {
-			Name: "VAULT_SECRETS_GLOBAL",
+			Name:  "VAULT_SECRETS_GLOBAL",
 			Value: db.Spec.VaultSecretsGlobal,
 		},
 	}
@@ -0,0 +1,692 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/ptr"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+func testBinding() *DaytonaBinding {
+	return &DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "binding",
+			Namespace:  "default",
+			Generation: 1,
+		},
+		Spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+		},
+	}
+}
+
+func testPod() *duckv1.WithPodable {
+	return &duckv1.WithPodable{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Namespace:   "default",
+			Annotations: map[string]string{},
+		},
+		Spec: duckv1.Podable{
+			Containers: []corev1.Container{{
+				Name:  "user-container",
+				Image: "busybox",
+				Env: []corev1.EnvVar{{
+					Name:  "K_REVISION",
+					Value: "foo-00001",
+				}},
+			}},
+		},
+	}
+}
+
+func getInitContainer(t *testing.T, pod *duckv1.WithPodable) corev1.Container {
+	t.Helper()
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == daytona.ContainerName {
+			return c
+		}
+	}
+	t.Fatalf("no %s init container in %v", daytona.ContainerName, pod.Spec.InitContainers)
+	return corev1.Container{}
+}
+
+func TestConditions(t *testing.T) {
+	dbs := &DaytonaBindingStatus{}
+	ready := func() *apis.Condition {
+		return dbs.GetCondition(DaytonaBindingConditionReady)
+	}
+
+	dbs.InitializeConditions()
+	for _, ct := range []apis.ConditionType{
+		DaytonaBindingConditionReady,
+		DaytonaBindingConditionSpecValid,
+		DaytonaBindingConditionSubjectResolved,
+		DaytonaBindingConditionProfileResolved,
+		DaytonaBindingConditionPolicyAllowed,
+		DaytonaBindingConditionWebhookProgrammed,
+		DaytonaBindingConditionSubjectsHealthy,
+	} {
+		if c := dbs.GetCondition(ct); c == nil || !c.IsUnknown() {
+			t.Errorf("%s = %v after InitializeConditions(), want Unknown", ct, c)
+		}
+	}
+
+	dbs.MarkSpecValid()
+	dbs.MarkBindingAvailable()
+	dbs.MarkProfileResolved()
+	dbs.MarkPolicyAllowed()
+	dbs.MarkWebhookProgrammed()
+	if c := ready(); c == nil || !c.IsUnknown() {
+		t.Errorf("Ready = %v before SubjectsHealthy is known, want Unknown", c)
+	}
+	dbs.MarkUnhealthySubjects(nil)
+	if c := ready(); c == nil || !c.IsTrue() {
+		t.Errorf("Ready = %v, want True", c)
+	}
+
+	// Informational conditions don't affect Ready.
+	dbs.MarkStaleSubjects([]string{"pod"})
+	dbs.MarkVaultConfigUnverified("RoleNotFound", "no role")
+	if c := ready(); c == nil || !c.IsTrue() {
+		t.Errorf("Ready = %v after informational conditions, want True", c)
+	}
+
+	dbs.MarkPolicyDenied(errors.New("image is not allowed"))
+	if c := ready(); c == nil || !c.IsFalse() || c.Reason != "ImageNotAllowed" {
+		t.Errorf("Ready = %v, want False with ImageNotAllowed", c)
+	}
+	dbs.MarkPolicyAllowed()
+	if c := ready(); c == nil || !c.IsTrue() {
+		t.Errorf("Ready = %v once the policy allows the image again, want True", c)
+	}
+
+	dbs.MarkBindingUnavailable("SubjectMissing", "deployment not found")
+	if c := dbs.GetCondition(DaytonaBindingConditionSubjectResolved); c == nil || !c.IsFalse() || c.Reason != "SubjectMissing" {
+		t.Errorf("SubjectResolved = %v, want False with SubjectMissing", c)
+	}
+	if c := ready(); c == nil || !c.IsFalse() || c.Reason != "SubjectMissing" {
+		t.Errorf("Ready = %v, want False with SubjectMissing", c)
+	}
+}
+
+func TestDoUndo(t *testing.T) {
+	renewal := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{RenewerImage: "gcr.io/dangerd-dev/renewer"},
+	})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		renewal *RenewalSpec
+		// restricted are the injected containers that must meet the
+		// restricted Pod Security profile.
+		restricted []string
+	}{{
+		name:       "daytona",
+		ctx:        context.Background(),
+		restricted: []string{daytona.ContainerName},
+	}, {
+		name:       "renewal",
+		ctx:        renewal,
+		renewal:    &RenewalSpec{},
+		restricted: []string{daytona.ContainerName, daytona.RenewerInstallContainerName, daytona.RenewerContainerName},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testBinding()
+			db.Spec.Renewal = test.renewal
+			pod := testPod()
+
+			db.Do(test.ctx, pod)
+
+			containers := map[string]corev1.Container{}
+			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				containers[c.Name] = c
+			}
+			for _, name := range test.restricted {
+				c, ok := containers[name]
+				if !ok {
+					t.Fatalf("Do() = %v, wanted container %q", pod.Spec, name)
+				}
+				if diff := cmp.Diff(daytona.DefaultSecurityContext(), c.SecurityContext); diff != "" {
+					t.Errorf("%s SecurityContext (-want, +got) = %s", name, diff)
+				}
+				if got, want := pod.Annotations[seccompAnnotation(name)], daytona.SeccompProfile; got != want {
+					t.Errorf("%s seccomp annotation = %q, want %q", name, got, want)
+				}
+			}
+			if got := len(pod.Spec.Containers[0].VolumeMounts); got != 1 {
+				t.Errorf("len(VolumeMounts) = %d, want 1", got)
+			}
+			for k, want := range map[string]string{
+				daytona.InjectedAnnotation:   "default/binding",
+				daytona.GenerationAnnotation: "1",
+				daytona.ConfigHashAnnotation: db.ConfigHash(),
+				daytona.ImageAnnotation:      db.Spec.Image,
+			} {
+				if got := pod.Annotations[k]; got != want {
+					t.Errorf("annotation %s = %q, want %q", k, got, want)
+				}
+			}
+
+			// Do must be idempotent.
+			again := pod.DeepCopy()
+			db.Do(test.ctx, again)
+			if diff := cmp.Diff(pod, again); diff != "" {
+				t.Errorf("Do is not idempotent (-want, +got) = %s", diff)
+			}
+
+			db.Undo(test.ctx, pod)
+			if want := testPod(); !equality.Semantic.DeepEqual(want, pod) {
+				t.Errorf("Undo (-want, +got) = %s", cmp.Diff(want, pod))
+			}
+		})
+	}
+}
+
+func TestUndoOtherBinding(t *testing.T) {
+	pod := testPod()
+	testBinding().Do(context.Background(), pod)
+	want := pod.DeepCopy()
+
+	other := testBinding()
+	other.Name = "other"
+	other.Undo(context.Background(), pod)
+	if diff := cmp.Diff(want, pod); diff != "" {
+		t.Errorf("Undo removed what another binding injected (-want, +got) = %s", diff)
+	}
+}
+
+func TestDoContainerOverrides(t *testing.T) {
+	db := testBinding()
+	db.Spec.Container = &ContainerSpec{
+		ImagePullPolicy: corev1.PullAlways,
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser: ptr.Int64(1000),
+		},
+	}
+	pod := testPod()
+
+	db.Do(context.Background(), pod)
+
+	c := getInitContainer(t, pod)
+	if c.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("ImagePullPolicy = %q, want %q", c.ImagePullPolicy, corev1.PullAlways)
+	}
+	want := daytona.DefaultSecurityContext()
+	want.RunAsUser = ptr.Int64(1000)
+	if diff := cmp.Diff(want, c.SecurityContext); diff != "" {
+		t.Errorf("SecurityContext (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(daytona.DefaultResources(), c.Resources); diff != "" {
+		t.Errorf("Resources (-want, +got) = %s", diff)
+	}
+}
+
+func TestDoSecretFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretFiles *SecretFilesSpec
+		daytonaSC   *corev1.SecurityContext
+		podSC       *corev1.PodSecurityContext
+		userSC      *corev1.SecurityContext
+		wantUser    int64
+		wantGroup   *int64
+		wantFSGroup *int64
+	}{{
+		name:     "unset",
+		wantUser: daytona.RunAsUser,
+	}, {
+		name:        "owner inferred from user container",
+		secretFiles: &SecretFilesSpec{Mode: SecretFilesModeOwner},
+		podSC:       &corev1.PodSecurityContext{RunAsUser: ptr.Int64(2000)},
+		userSC:      &corev1.SecurityContext{RunAsUser: ptr.Int64(1000)},
+		wantUser:    1000,
+	}, {
+		name:        "owner root user container",
+		secretFiles: &SecretFilesSpec{Mode: SecretFilesModeOwner},
+		userSC:      &corev1.SecurityContext{RunAsUser: ptr.Int64(0)},
+		wantUser:    daytona.RunAsUser,
+	}, {
+		name:        "explicit owner",
+		secretFiles: &SecretFilesSpec{Mode: SecretFilesModeOwner, Owner: ptr.Int64(3000)},
+		wantUser:    3000,
+	}, {
+		name:        "owner keeps explicit daytona user",
+		secretFiles: &SecretFilesSpec{Mode: SecretFilesModeOwner},
+		daytonaSC:   &corev1.SecurityContext{RunAsUser: ptr.Int64(6000)},
+		userSC:      &corev1.SecurityContext{RunAsUser: ptr.Int64(1000)},
+		wantUser:    6000,
+	}, {
+		name:        "group sets fsGroup",
+		secretFiles: &SecretFilesSpec{Mode: SecretFilesModeGroup, Owner: ptr.Int64(4000)},
+		wantUser:    daytona.RunAsUser,
+		wantGroup:   ptr.Int64(4000),
+		wantFSGroup: ptr.Int64(4000),
+	}, {
+		name:        "group reuses fsGroup",
+		secretFiles: &SecretFilesSpec{Mode: SecretFilesModeGroup},
+		podSC:       &corev1.PodSecurityContext{FSGroup: ptr.Int64(5000)},
+		wantUser:    daytona.RunAsUser,
+		wantGroup:   ptr.Int64(5000),
+		wantFSGroup: ptr.Int64(5000),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testBinding()
+			db.Spec.SecretFiles = test.secretFiles
+			if test.daytonaSC != nil {
+				db.Spec.Container = &ContainerSpec{SecurityContext: test.daytonaSC}
+			}
+			pod := testPod()
+			pod.Spec.SecurityContext = test.podSC
+			pod.Spec.Containers[0].SecurityContext = test.userSC
+			want := pod.DeepCopy()
+
+			db.Do(context.Background(), pod)
+
+			sc := getInitContainer(t, pod).SecurityContext
+			if got := *sc.RunAsUser; got != test.wantUser {
+				t.Errorf("RunAsUser = %d, want %d", got, test.wantUser)
+			}
+			if diff := cmp.Diff(test.wantGroup, sc.RunAsGroup); diff != "" {
+				t.Errorf("RunAsGroup (-want, +got) = %s", diff)
+			}
+			var fsGroup *int64
+			if pod.Spec.SecurityContext != nil {
+				fsGroup = pod.Spec.SecurityContext.FSGroup
+			}
+			if diff := cmp.Diff(test.wantFSGroup, fsGroup); diff != "" {
+				t.Errorf("FSGroup (-want, +got) = %s", diff)
+			}
+
+			// Undo only removes the fsGroup we set.
+			db.Undo(context.Background(), pod)
+			if !equality.Semantic.DeepEqual(want, pod) {
+				t.Errorf("Undo (-want, +got) = %s", cmp.Diff(want, pod))
+			}
+		})
+	}
+}
+
+func TestDoVolume(t *testing.T) {
+	db := testBinding()
+	sizeLimit := resource.MustParse("1Mi")
+	db.Spec.Volume = &VolumeSpec{
+		SizeLimit: &sizeLimit,
+		Medium:    VolumeMediumDisk,
+		MountPath: "/etc/secrets",
+		SubPath:   "app",
+		ReadOnly:  true,
+	}
+	pod := testPod()
+
+	db.Do(context.Background(), pod)
+
+	want := corev1.Volume{
+		Name: daytona.SecretVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium:    corev1.StorageMediumDefault,
+				SizeLimit: &sizeLimit,
+			},
+		},
+	}
+	if got := pod.Spec.Volumes; len(got) != 1 || !equality.Semantic.DeepEqual(want, got[0]) {
+		t.Errorf("Volumes = %v, want [%v]", got, want)
+	}
+	wantMount := corev1.VolumeMount{
+		Name:      daytona.SecretVolumeName,
+		MountPath: "/etc/secrets",
+		SubPath:   "app",
+		ReadOnly:  true,
+	}
+	if diff := cmp.Diff([]corev1.VolumeMount{wantMount}, pod.Spec.Containers[0].VolumeMounts); diff != "" {
+		t.Errorf("VolumeMounts (-want, +got) = %s", diff)
+	}
+}
+
+func TestDoReadinessGate(t *testing.T) {
+	db := testBinding()
+	db.Spec.ReadinessGate = true
+	pod := testPod()
+	pod.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: "user"}}
+	want := pod.DeepCopy()
+
+	db.Do(context.Background(), pod)
+	db.Do(context.Background(), pod)
+
+	wantGates := []corev1.PodReadinessGate{
+		{ConditionType: "user"},
+		{ConditionType: daytona.SecretsReadyCondition},
+	}
+	if diff := cmp.Diff(wantGates, pod.Spec.ReadinessGates); diff != "" {
+		t.Errorf("ReadinessGates (-want, +got) = %s", diff)
+	}
+
+	db.Undo(context.Background(), pod)
+	if diff := cmp.Diff(want.Spec.ReadinessGates, pod.Spec.ReadinessGates); diff != "" {
+		t.Errorf("ReadinessGates after Undo (-want, +got) = %s", diff)
+	}
+}
+
+func TestDoRenewal(t *testing.T) {
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{RenewerImage: "gcr.io/dangerd-dev/renewer"},
+	})
+	db := testBinding()
+	db.Spec.TokenPath = daytona.SecretMountPath + "/token"
+	db.Spec.Renewal = &RenewalSpec{
+		Interval:              &metav1.Duration{Duration: time.Minute},
+		FailureThreshold:      ptr.Int32(2),
+		ShareProcessNamespace: true,
+		Reload:                &ReloadSpec{Container: "user-container", Signal: "SIGHUP"},
+	}
+	pod := testPod()
+
+	db.Do(ctx, pod)
+
+	dc := getInitContainer(t, pod)
+	var install, renewer *corev1.Container
+	for i, c := range pod.Spec.InitContainers {
+		if c.Name == daytona.RenewerInstallContainerName {
+			install = &pod.Spec.InitContainers[i]
+		}
+	}
+	for i, c := range pod.Spec.Containers {
+		if c.Name == daytona.RenewerContainerName {
+			renewer = &pod.Spec.Containers[i]
+		}
+	}
+	if install == nil || renewer == nil {
+		t.Fatalf("Do() = %v, wanted the renewer install and sidecar containers", pod.Spec)
+	}
+	if got, want := install.Image, "gcr.io/dangerd-dev/renewer"; got != want {
+		t.Errorf("install Image = %q, wanted %q", got, want)
+	}
+	if diff := cmp.Diff([]string{"install", daytona.RenewerBinary}, install.Args); diff != "" {
+		t.Errorf("install Args (-want, +got) = %s", diff)
+	}
+	if got, want := renewer.Image, dc.Image; got != want {
+		t.Errorf("renewer Image = %q, wanted %q", got, want)
+	}
+	if diff := cmp.Diff(dc.Env, renewer.Env); diff != "" {
+		t.Errorf("renewer Env (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(dc.SecurityContext, renewer.SecurityContext); diff != "" {
+		t.Errorf("renewer SecurityContext (-want, +got) = %s", diff)
+	}
+	wantCommand := []string{
+		daytona.RenewerBinary, "run",
+		"--interval=1m0s",
+		"--failure-threshold=2",
+		"--secrets-dir=" + daytona.SecretMountPath,
+		"--ready-file=" + daytona.RenewerReadyFile,
+		"--ignore=" + daytona.SecretMountPath + "/token",
+		"--reload-signal=SIGHUP",
+		"--", "daytona",
+	}
+	if diff := cmp.Diff(wantCommand, renewer.Command); diff != "" {
+		t.Errorf("renewer Command (-want, +got) = %s", diff)
+	}
+	if renewer.ReadinessProbe == nil || renewer.ReadinessProbe.Exec == nil {
+		t.Errorf("renewer ReadinessProbe = %v, wanted an exec probe", renewer.ReadinessProbe)
+	}
+	wantEnv := corev1.EnvVar{Name: daytona.ReloadTargetEnv, Value: daytona.ReloadTargetEnv}
+	if env := pod.Spec.Containers[0].Env; env[len(env)-1] != wantEnv {
+		t.Errorf("user container Env = %v, wanted %v", env, wantEnv)
+	}
+	if sp := pod.Spec.ShareProcessNamespace; sp == nil || !*sp {
+		t.Errorf("ShareProcessNamespace = %v, wanted true", sp)
+	}
+
+	// Do must be idempotent.
+	again := pod.DeepCopy()
+	db.Do(ctx, again)
+	if diff := cmp.Diff(pod, again); diff != "" {
+		t.Errorf("Do is not idempotent (-want, +got) = %s", diff)
+	}
+
+	db.Undo(ctx, pod)
+	if want := testPod(); !equality.Semantic.DeepEqual(want, pod) {
+		t.Errorf("Undo (-want, +got) = %s", cmp.Diff(want, pod))
+	}
+}
+
+func TestDoRenewalHTTPReload(t *testing.T) {
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{RenewerImage: "gcr.io/dangerd-dev/renewer"},
+	})
+	db := testBinding()
+	db.Spec.Renewal = &RenewalSpec{
+		Reload: &ReloadSpec{Container: "user-container", HTTPPost: &HTTPReload{Port: 8080, Path: "/-/reload"}},
+	}
+	pod := testPod()
+	pod.Spec.ShareProcessNamespace = ptr.Bool(true)
+	want := pod.DeepCopy()
+
+	db.Do(ctx, pod)
+
+	renewer := pod.Spec.Containers[len(pod.Spec.Containers)-1]
+	wantCommand := []string{
+		daytona.RenewerBinary, "run",
+		"--interval=5m0s",
+		"--failure-threshold=3",
+		"--secrets-dir=" + daytona.SecretMountPath,
+		"--ready-file=" + daytona.RenewerReadyFile,
+		"--reload-url=http://localhost:8080/-/reload",
+		"--", "daytona",
+	}
+	if diff := cmp.Diff(wantCommand, renewer.Command); diff != "" {
+		t.Errorf("renewer Command (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(want.Spec.Containers[0].Env, pod.Spec.Containers[0].Env); diff != "" {
+		t.Errorf("user container Env (-want, +got) = %s", diff)
+	}
+
+	// The process namespace the Pod already shared is left shared.
+	db.Undo(ctx, pod)
+	if !equality.Semantic.DeepEqual(want, pod) {
+		t.Errorf("Undo (-want, +got) = %s", cmp.Diff(want, pod))
+	}
+}
+
+func TestDoRenewalDenied(t *testing.T) {
+	configured := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{RenewerImage: "gcr.io/dangerd-dev/renewer"},
+	})
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		renewal *RenewalSpec
+	}{{
+		name:    "no renewer image",
+		ctx:     context.Background(),
+		renewal: &RenewalSpec{},
+	}, {
+		name: "no container to reload",
+		ctx:  configured,
+		renewal: &RenewalSpec{
+			Reload: &ReloadSpec{Container: "app", HTTPPost: &HTTPReload{Port: 8080}},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testBinding()
+			db.Spec.Renewal = test.renewal
+			pod := testPod()
+			want := pod.DeepCopy()
+
+			db.Do(test.ctx, pod)
+			if diff := cmp.Diff(want, pod); diff != "" {
+				t.Errorf("Do mutated a denied pod (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestDoDryRun(t *testing.T) {
+	db := testBinding()
+	db.Spec.Enforcement = EnforcementDryRun
+	db.Spec.VaultAuthRole = "app"
+	db.Spec.VaultSecretsApp = "secret/app"
+
+	pod := testPod()
+	db.Do(context.Background(), pod)
+
+	want := testPod()
+	want.Annotations[daytona.DryRunAnnotation] = `{"binding":"default/binding","image":"gcr.io/dangerd-dev/daytona",` +
+		`"role":"app","secretPaths":["secret/app"]}`
+	if diff := cmp.Diff(want, pod); diff != "" {
+		t.Errorf("Do (-want, +got) = %s", diff)
+	}
+	if got := db.GetFailurePolicy(); got != admissionregistrationv1beta1.Ignore {
+		t.Errorf("GetFailurePolicy() = %v, wanted Ignore", got)
+	}
+
+	// What would have been denied is reported, but not denied.
+	colliding := testPod()
+	colliding.Spec.Volumes = []corev1.Volume{{Name: daytona.SecretVolumeName}}
+	db.Do(context.Background(), colliding)
+	var dr daytona.DryRun
+	if err := json.Unmarshal([]byte(colliding.Annotations[daytona.DryRunAnnotation]), &dr); err != nil {
+		t.Fatalf("Unmarshal() = %v", err)
+	}
+	if dr.Denied == "" {
+		t.Error("Denied = \"\", wanted the conflict")
+	}
+
+	// Enforcing replaces the annotation with the injection.
+	db.Spec.Enforcement = EnforcementEnforce
+	db.Do(context.Background(), pod)
+	if _, ok := pod.Annotations[daytona.DryRunAnnotation]; ok {
+		t.Error("Do() kept the dry-run annotation when enforcing")
+	}
+	getInitContainer(t, pod)
+
+	db.Undo(context.Background(), pod)
+	if want := testPod(); !equality.Semantic.DeepEqual(want, pod) {
+		t.Errorf("Undo (-want, +got) = %s", cmp.Diff(want, pod))
+	}
+}
+
+func TestDoMountPathCollision(t *testing.T) {
+	db := testBinding()
+	pod := testPod()
+	pod.Spec.Volumes = []corev1.Volume{{Name: "mine"}}
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{
+		Name:      "mine",
+		MountPath: daytona.SecretMountPath,
+	}}
+	want := pod.DeepCopy()
+
+	db.Do(context.Background(), pod)
+
+	if diff := cmp.Diff(want, pod); diff != "" {
+		t.Errorf("Do mutated a colliding pod (-want, +got) = %s", diff)
+	}
+}
+
+func TestNameCollisions(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*duckv1.WithPodable)
+	}{{
+		name: "volume",
+		mutate: func(pod *duckv1.WithPodable) {
+			pod.Spec.Volumes = []corev1.Volume{{Name: daytona.SecretVolumeName}}
+			pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{
+				Name:      daytona.SecretVolumeName,
+				MountPath: "/data",
+			}}
+		},
+	}, {
+		name: "init container",
+		mutate: func(pod *duckv1.WithPodable) {
+			pod.Spec.InitContainers = []corev1.Container{{Name: daytona.ContainerName}}
+		},
+	}, {
+		name: "sidecar",
+		mutate: func(pod *duckv1.WithPodable) {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: daytona.ContainerName})
+		},
+	}, {
+		name: "renewer sidecar",
+		mutate: func(pod *duckv1.WithPodable) {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: daytona.RenewerContainerName})
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testBinding()
+			pod := testPod()
+			test.mutate(pod)
+			want := pod.DeepCopy()
+
+			db.Do(context.Background(), pod)
+			if diff := cmp.Diff(want, pod); diff != "" {
+				t.Errorf("Do mutated a colliding pod (-want, +got) = %s", diff)
+			}
+
+			db.Undo(context.Background(), pod)
+			if diff := cmp.Diff(want, pod); diff != "" {
+				t.Errorf("Undo removed what it did not inject (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	db := testBinding()
+	hash := db.ConfigHash()
+
+	// Changes that don't affect what we inject keep the hash.
+	other := db.DeepCopy()
+	other.Generation++
+	other.Spec.Subject.Selector.MatchLabels["app"] = "bar"
+	if got := other.ConfigHash(); got != hash {
+		t.Errorf("ConfigHash() = %s, want %s", got, hash)
+	}
+
+	// Changes to what we inject change the hash.
+	other.Spec.VaultAuthRole = "another-role"
+	if got := other.ConfigHash(); got == hash {
+		t.Errorf("ConfigHash() = %s, wanted a different hash", got)
+	}
+}
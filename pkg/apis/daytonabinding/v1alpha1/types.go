@@ -17,9 +17,13 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
 	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/tracker"
@@ -75,12 +79,326 @@ type DaytonaBindingSpec struct {
 	VaultSecretsApp string `json:"vaultSecretsApp"`
 
 	VaultSecretsGlobal string `json:"vaultSecretsGlobal"`
-	
+
+	// Container holds overrides for the injected daytona container.
+	// +optional
+	Container *ContainerSpec `json:"container,omitempty"`
+
+	// SecretFiles controls the ownership of the secret files written by
+	// daytona, so that they are readable by a non-root user container.
+	// An explicit container.securityContext.runAsUser takes precedence over
+	// the Owner mode. Subjects whose files may end up unreadable are still
+	// admitted, with the reason in a warning of the admission response and
+	// in the webhook logs.
+	// +optional
+	SecretFiles *SecretFilesSpec `json:"secretFiles,omitempty"`
+
+	// Volume configures the volume daytona writes the secrets to, and how
+	// it is mounted into the user container.
+	// +optional
+	Volume *VolumeSpec `json:"volume,omitempty"`
+
+	// Renewal runs daytona in a sidecar too, which rewrites the secrets at
+	// an interval while the subjects run, and may tell them when the
+	// secrets changed. Without it, daytona only writes the secrets once,
+	// before the subjects start.
+	// +optional
+	Renewal *RenewalSpec `json:"renewal,omitempty"`
+
+	// ReadinessGate adds the daytona.binding.app/secrets-ready readiness
+	// gate to the subjects, so that they are only Ready while the renewer
+	// keeps the secrets up to date, and no longer once it failed to renew
+	// them failureThreshold times in a row. Requires renewal.
+	// +optional
+	ReadinessGate bool `json:"readinessGate,omitempty"`
+
+	// Suspend pauses the binding without deleting it: the Pods created
+	// while it is suspended aren't injected, and the controller leaves the
+	// existing subjects alone.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Enforcement is either Enforce (the default), which injects daytona
+	// into the subjects, or DryRun, which only annotates them with the
+	// injection that would have happened, under daytona.binding.app/dry-run.
+	// Subjects are never rejected in DryRun.
+	// +optional
+	Enforcement Enforcement `json:"enforcement,omitempty"`
+
+	// FailurePolicy is either Fail (the default) or Ignore. Fail rejects the
+	// subjects' admission when the webhook is unavailable, so they never run
+	// without their secrets; Ignore admits them uninjected. Fail applies to
+	// every namespace holding a binding that sets it; on clusters older than
+	// 1.21 it applies to every namespace if any binding sets Fail.
+	// +optional
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+
+	// RolloutPolicy controls what happens to subjects running with an
+	// outdated injected configuration, either Manual (the default) or
+	// RestartOwners.
+	// +optional
+	RolloutPolicy RolloutPolicy `json:"rolloutPolicy,omitempty"`
+
+	// MaxConcurrentRollouts is the number of owning workloads that may be
+	// restarting at once under the RestartOwners policy. Defaults to 1.
+	// +optional
+	MaxConcurrentRollouts *int32 `json:"maxConcurrentRollouts,omitempty"`
+
+	// AuditSink is where the webhook posts a CloudEvent for each admission
+	// decision about the subjects, carrying the Vault role and secret
+	// paths they were given, but never the secrets. Its ref, to a Service
+	// or to any Addressable, must be in the binding's namespace, and its
+	// uri may only add a path.
+	// +optional
+	AuditSink *duckv1.Destination `json:"auditSink,omitempty"`
+}
+
+// Enforcement is whether a binding injects its subjects.
+type Enforcement string
+
+const (
+	// EnforcementEnforce injects daytona into the subjects.
+	EnforcementEnforce Enforcement = "Enforce"
+
+	// EnforcementDryRun only annotates the subjects with the injection that
+	// would have happened.
+	EnforcementDryRun Enforcement = "DryRun"
+)
+
+// FailurePolicy is how the admission of subjects is handled when the webhook
+// can't be called.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail rejects the subjects, so that they never run
+	// without their secrets.
+	FailurePolicyFail FailurePolicy = "Fail"
+
+	// FailurePolicyIgnore admits the subjects without their secrets.
+	FailurePolicyIgnore FailurePolicy = "Ignore"
+)
+
+// RolloutPolicy is the strategy used to bring stale subjects up to date.
+type RolloutPolicy string
+
+const (
+	// RolloutPolicyManual leaves stale subjects alone, they pick up the
+	// current configuration whenever they are next recreated.
+	RolloutPolicyManual RolloutPolicy = "Manual"
+
+	// RolloutPolicyRestartOwners restarts the Deployments, StatefulSets and
+	// DaemonSets owning stale subjects, as "kubectl rollout restart" would.
+	RolloutPolicyRestartOwners RolloutPolicy = "RestartOwners"
+)
+
+// ContainerSpec holds the overrides for the injected daytona container. Unset
+// fields keep their defaults, which comply with the "restricted" Pod Security
+// Standard.
+type ContainerSpec struct {
+	// Resources are merged over the default requests and limits, per resource.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// ImagePullPolicy of the daytona container.
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// SecurityContext is merged over the default security context, per field.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+}
+
+// SecretFilesMode is the strategy used to make the secret files readable by
+// the user container.
+type SecretFilesMode string
+
+const (
+	// SecretFilesModeOwner runs daytona as the UID of the user container,
+	// so that the secret files it writes are owned by that UID.
+	SecretFilesModeOwner SecretFilesMode = "Owner"
+
+	// SecretFilesModeGroup runs daytona with the pod's fsGroup as its
+	// group, setting the pod's fsGroup when it has none, so that the
+	// secret files are owned by a group every container belongs to.
+	SecretFilesModeGroup SecretFilesMode = "Group"
+)
+
+// SecretFilesSpec controls the ownership of the secret files written by daytona.
+type SecretFilesSpec struct {
+	// Mode is the strategy used to make the secret files readable, either
+	// Owner (the default) or Group.
+	// +optional
+	Mode SecretFilesMode `json:"mode,omitempty"`
+
+	// Owner is the UID (Owner mode) or GID (Group mode) that should own the
+	// secret files. When omitted, it is inferred from the user container's
+	// runAsUser (Owner mode) or the pod's fsGroup (Group mode).
+	// +optional
+	Owner *int64 `json:"owner,omitempty"`
+}
+
+// VolumeMedium is the storage medium backing the secrets volume.
+type VolumeMedium string
+
+const (
+	// VolumeMediumMemory backs the secrets volume with tmpfs.
+	VolumeMediumMemory VolumeMedium = "Memory"
+
+	// VolumeMediumDisk backs the secrets volume with the node's disk.
+	VolumeMediumDisk VolumeMedium = "Disk"
+)
+
+// VolumeSpec configures the secrets volume.
+type VolumeSpec struct {
+	// SizeLimit is the maximum size of the secrets volume.
+	// +optional
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
+
+	// Medium backing the secrets volume, either Memory (the default) or Disk.
+	// +optional
+	Medium VolumeMedium `json:"medium,omitempty"`
+
+	// MountPath is where the secrets are mounted in the user container.
+	// Defaults to /home/vault/secrets.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// SubPath of the secrets volume to mount in the user container.
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+
+	// ReadOnly mounts the secrets read-only in the user container.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+// RenewalSpec configures the sidecar keeping the secrets up to date.
+type RenewalSpec struct {
+	// Interval is the time between two rewrites of the secrets. Defaults
+	// to 5m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// FailureThreshold is the number of consecutive failed rewrites after
+	// which the sidecar is no longer Ready. Defaults to 3.
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+
+	// Command runs daytona in its image. Defaults to ["daytona"], which is
+	// looked up in the PATH of the image.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// ShareProcessNamespace enables shareProcessNamespace on the subjects,
+	// which signalling a container requires.
+	// +optional
+	ShareProcessNamespace bool `json:"shareProcessNamespace,omitempty"`
+
+	// Reload tells a container of the subjects that its secrets changed,
+	// whenever a rewrite changes them.
+	// +optional
+	Reload *ReloadSpec `json:"reload,omitempty"`
+}
+
+// ReloadSpec configures how a container is told that its secrets changed,
+// either with a signal or with an HTTP request.
+type ReloadSpec struct {
+	// Container is the name of the container to reload, which every
+	// subject must have.
+	Container string `json:"container"`
+
+	// Signal is sent to the main process of the container, e.g. SIGHUP. It
+	// requires shareProcessNamespace, and the daytona containers to run as
+	// the user of the container, as only its user may signal a process.
+	// +optional
+	Signal string `json:"signal,omitempty"`
+
+	// HTTPPost is a reload endpoint of the container, which is POSTed to
+	// on localhost.
+	// +optional
+	HTTPPost *HTTPReload `json:"httpPost,omitempty"`
+}
+
+// HTTPReload is a reload endpoint served on localhost.
+type HTTPReload struct {
+	// Port is the port the endpoint is served on.
+	Port int32 `json:"port"`
+
+	// Path is the path of the endpoint. Defaults to /.
+	// +optional
+	Path string `json:"path,omitempty"`
 }
 
 // DaytonaBindingStatus communicates the observed state of the DaytonaBinding (from the controller).
 type DaytonaBindingStatus struct {
 	duckv1beta1.Status `json:",inline"`
+
+	// ResolvedImage is spec.image pinned to the digest its tag pointed at
+	// when it was first reconciled. It is only populated when tag
+	// resolution is enabled in the config-daytona ConfigMap.
+	// +optional
+	ResolvedImage string `json:"resolvedImage,omitempty"`
+
+	// StaleSubjects lists the subjects running with an outdated injected
+	// configuration, which must be recreated to pick up the current one.
+	// +optional
+	StaleSubjects *SubjectList `json:"staleSubjects,omitempty"`
+
+	// UnhealthySubjects lists the subjects whose daytona container is
+	// failing to deliver the secrets.
+	// +optional
+	UnhealthySubjects *SubjectList `json:"unhealthySubjects,omitempty"`
+
+	// LastSecretVersion maps each Vault path the binding injects to the
+	// version of its KV v2 secret last seen by the controller. It is only
+	// populated when a vault-address is set in the config-daytona
+	// ConfigMap.
+	// +optional
+	LastSecretVersion map[string]int64 `json:"lastSecretVersion,omitempty"`
+
+	// SecretsRotatedAt is when the controller last saw the version of one
+	// of the binding's secrets change. The subjects created before it are
+	// stale.
+	// +optional
+	SecretsRotatedAt *metav1.Time `json:"secretsRotatedAt,omitempty"`
+
+	// MatchedSubjects lists the subjects the binding's subject reference
+	// currently resolves to.
+	// +optional
+	MatchedSubjects *SubjectList `json:"matchedSubjects,omitempty"`
+
+	// InjectedPods is the number of live Pods injected by the binding.
+	// +optional
+	InjectedPods int32 `json:"injectedPods,omitempty"`
+
+	// LastInjectionTime is the creation time of the last Pod injected by
+	// the binding.
+	// +optional
+	LastInjectionTime *metav1.Time `json:"lastInjectionTime,omitempty"`
+
+	// AnnouncedPods are the UIDs of the live Pods injected by the binding
+	// that the controller emitted an Injected Event on.
+	// +optional
+	AnnouncedPods []types.UID `json:"announcedPods,omitempty"`
+
+	// MatchedPods is, in DryRun, the number of Pods annotated with the
+	// injection that would have happened.
+	// +optional
+	MatchedPods int32 `json:"matchedPods,omitempty"`
+
+	// AuditSinkURI is the resolved URI of spec.auditSink.
+	// +optional
+	AuditSinkURI *apis.URL `json:"auditSinkUri,omitempty"`
+}
+
+// SubjectList is a count of subjects along with a capped list of their names.
+type SubjectList struct {
+	// Count is the number of subjects.
+	Count int32 `json:"count"`
+
+	// Names of the subjects, sorted and capped at MaxSubjectNames.
+	// +optional
+	Names []string `json:"names,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -91,4 +409,4 @@ type DaytonaBindingList struct {
 	metav1.ListMeta `json:"metadata"`
 
 	Items []DaytonaBinding `json:"items"`
-}
\ No newline at end of file
+}
@@ -18,18 +18,415 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+	"github.com/dgerd/daytona-binding/pkg/registry"
+	"github.com/dgerd/daytona-binding/pkg/renewal"
 )
 
+// AllowAuthChangeAnnotation must be set to "true" on a binding for an update
+// to change its auth method, which the subjects injected with the previous
+// one keep using until they are recreated.
+const AllowAuthChangeAnnotation = daytona.AnnotationPrefix + "allow-auth-change"
+
 // Validate implements apis.Validatable
 func (db *DaytonaBinding) Validate(ctx context.Context) *apis.FieldError {
-	return db.Spec.Validate(ctx).ViaField("spec")
+	// A status update doesn't change the spec, and must go through for the
+	// bindings stored before the validation or the policy was tightened, so
+	// that the controller can report them SpecValid or PolicyAllowed False.
+	if apis.IsInStatusUpdate(ctx) {
+		return nil
+	}
+	err := db.Spec.Validate(ctx).ViaField("spec")
+	if db.checksImagePolicy(ctx) {
+		if ierr := config.FromContextOrDefaults(ctx).Daytona.CheckSpecImage(db.Spec.Image); ierr != nil {
+			err = err.Also(&apis.FieldError{
+				Message: ierr.Error(),
+				Paths:   []string{"spec.image"},
+			})
+		}
+	}
+	// The controller logs in to Vault with tokens minted for the service
+	// account of the subjects, which must not be another namespace's.
+	if ns := db.Spec.Subject.Namespace; ns != "" && ns != db.Namespace {
+		err = err.Also(&apis.FieldError{
+			Message: fmt.Sprintf("must be the binding's namespace %q", db.Namespace),
+			Paths:   []string{"spec.subject.namespace"},
+		})
+	}
+	if as := db.Spec.AuditSink; as != nil {
+		err = err.Also(db.validateAuditSink(as).ViaField("spec", "auditSink"))
+	}
+	if apis.IsInUpdate(ctx) {
+		if original, ok := apis.GetBaseline(ctx).(*DaytonaBinding); ok && original != nil {
+			err = err.Also(db.validateUpdate(original))
+		}
+	}
+	return err
+}
+
+// checksImagePolicy returns whether the image must be permitted by the
+// current policy, which is only the case when it is set or changed.
+// Tightening the policy mustn't keep the controller from updating the
+// bindings stored before, e.g. to remove their finalizers: it is enforced on
+// those by reconcilePolicy and Do instead.
+func (db *DaytonaBinding) checksImagePolicy(ctx context.Context) bool {
+	if db.Spec.Image == "" || db.DeletionTimestamp != nil {
+		return false
+	}
+	if apis.IsInUpdate(ctx) {
+		if original, ok := apis.GetBaseline(ctx).(*DaytonaBinding); ok && original != nil {
+			return original.Spec.Image != db.Spec.Image
+		}
+	}
+	return true
+}
+
+// Warnings returns descriptions of the risks the binding, while valid, puts
+// its subjects at.
+func (db *DaytonaBinding) Warnings(ctx context.Context) []string {
+	var warnings []string
+	if sel := db.Spec.Subject.Selector; sel != nil && len(sel.MatchLabels) == 0 && len(sel.MatchExpressions) == 0 {
+		warnings = append(warnings, fmt.Sprintf("spec.subject.selector is empty, so it selects every %s in namespace %q",
+			db.Spec.Subject.Kind, db.Spec.Subject.Namespace))
+	}
+	if auth, _ := strconv.ParseBool(db.Spec.Auth); !auth && len(db.SecretPaths()) > 0 {
+		warnings = append(warnings, "spec.auth is disabled, so daytona reads the secrets with whatever Vault token the Pod already has")
+	}
+	// The reconciler pins the image it injects when resolve-image-tags is
+	// enabled.
+	if ref, err := registry.ParseReference(db.GetImage()); err == nil && !ref.HasDigest() &&
+		!config.FromContextOrDefaults(ctx).Daytona.ResolveImageTags {
+		warnings = append(warnings, fmt.Sprintf("image %q isn't pinned by digest, so Pods created at different times may run different daytona builds", db.GetImage()))
+	}
+	if db.Spec.VaultSecretsGlobal != "" {
+		warnings = append(warnings, fmt.Sprintf("spec.vaultSecretsGlobal shares the secrets at %q with every workload whose role may read them",
+			db.Spec.VaultSecretsGlobal))
+	}
+	return warnings
+}
+
+// validateAuditSink checks that the audit sink is addressed within the
+// binding's namespace, as it is the controller and webhook that call it: an
+// absolute URI, or a ref to another namespace, would have them reach what the
+// binding's author can't.
+func (db *DaytonaBinding) validateAuditSink(as *duckv1.Destination) *apis.FieldError {
+	var errs *apis.FieldError
+	if as.Ref == nil {
+		errs = errs.Also(apis.ErrMissingField("ref"))
+	} else if ns := as.Ref.Namespace; ns != "" && ns != db.Namespace {
+		errs = errs.Also(&apis.FieldError{
+			Message: fmt.Sprintf("must be the binding's namespace %q", db.Namespace),
+			Paths:   []string{"ref.namespace"},
+		})
+	}
+	if uri := as.URI; uri != nil && (uri.Scheme != "" || uri.Host != "") {
+		errs = errs.Also(&apis.FieldError{
+			Message: "must be a path relative to the ref",
+			Paths:   []string{"uri"},
+		})
+	}
+	return errs
+}
+
+// validateUpdate checks that an update doesn't change what the subjects
+// were bound with in ways that strand them. The subjects of another kind
+// would keep their injection, and lose track of the binding, while the
+// subjects injected with another auth method can't reach Vault once it is
+// torn down.
+func (db *DaytonaBinding) validateUpdate(original *DaytonaBinding) *apis.FieldError {
+	var errs *apis.FieldError
+	for _, f := range []struct {
+		path     string
+		old, new string
+	}{
+		{"spec.subject.apiVersion", original.Spec.Subject.APIVersion, db.Spec.Subject.APIVersion},
+		{"spec.subject.kind", original.Spec.Subject.Kind, db.Spec.Subject.Kind},
+	} {
+		if f.old != f.new {
+			errs = errs.Also(&apis.FieldError{
+				Message: "Immutable field changed",
+				Paths:   []string{f.path},
+				Details: fmt.Sprintf("%q was changed to %q, create a new binding instead", f.old, f.new),
+			})
+		}
+	}
+
+	if db.Annotations[AllowAuthChangeAnnotation] == "true" {
+		return errs
+	}
+	for _, f := range []struct {
+		path     string
+		old, new string
+	}{
+		{"spec.auth", original.Spec.Auth, db.Spec.Auth},
+		{"spec.authMount", original.Spec.AuthMount, db.Spec.AuthMount},
+	} {
+		if f.old != f.new {
+			errs = errs.Also(&apis.FieldError{
+				Message: fmt.Sprintf("Changing the auth method requires the %s: \"true\" annotation", AllowAuthChangeAnnotation),
+				Paths:   []string{f.path},
+				Details: fmt.Sprintf("%q was changed to %q", f.old, f.new),
+			})
+		}
+	}
+	return errs
 }
 
 // Validate implements apis.Validatable
 func (dbs *DaytonaBindingSpec) Validate(ctx context.Context) *apis.FieldError {
 	err := dbs.Subject.Validate(ctx).ViaField("subject")
 
+	if dbs.Image == "" {
+		err = err.Also(apis.ErrMissingField("image"))
+	}
+
+	if dbs.Container != nil {
+		err = err.Also(dbs.Container.Validate(ctx).ViaField("container"))
+	}
+
+	if dbs.Volume != nil {
+		err = err.Also(dbs.Volume.Validate(ctx).ViaField("volume"))
+	}
+
+	if sf := dbs.SecretFiles; sf != nil {
+		err = err.Also(sf.Validate(ctx).ViaField("secretFiles"))
+		if sf.Mode != SecretFilesModeGroup && sf.Owner != nil &&
+			dbs.Container != nil && dbs.Container.SecurityContext != nil && dbs.Container.SecurityContext.RunAsUser != nil {
+			err = err.Also(apis.ErrMultipleOneOf("container.securityContext.runAsUser", "secretFiles.owner"))
+		}
+	}
+
+	if dbs.AuditSink != nil {
+		err = err.Also(dbs.AuditSink.Validate(ctx).ViaField("auditSink"))
+	}
+
+	if dbs.Renewal != nil {
+		err = err.Also(dbs.Renewal.Validate(ctx).ViaField("renewal"))
+	} else if dbs.ReadinessGate {
+		// Init containers complete before any container starts, so only
+		// the renewer can take the secrets away from a running subject.
+		err = err.Also(&apis.FieldError{
+			Message: "readinessGate requires renewal",
+			Paths:   []string{"readinessGate"},
+		})
+	}
+
+	switch dbs.Enforcement {
+	case "", EnforcementEnforce, EnforcementDryRun:
+	default:
+		err = err.Also(apis.ErrInvalidValue(dbs.Enforcement, "enforcement"))
+	}
+
+	switch dbs.FailurePolicy {
+	case "", FailurePolicyFail, FailurePolicyIgnore:
+	default:
+		err = err.Also(apis.ErrInvalidValue(dbs.FailurePolicy, "failurePolicy"))
+	}
+
+	switch dbs.RolloutPolicy {
+	case "", RolloutPolicyManual:
+		if dbs.MaxConcurrentRollouts != nil {
+			err = err.Also(&apis.FieldError{
+				Message: "must not be set unless rolloutPolicy is " + string(RolloutPolicyRestartOwners),
+				Paths:   []string{"maxConcurrentRollouts"},
+			})
+		}
+	case RolloutPolicyRestartOwners:
+		if m := dbs.MaxConcurrentRollouts; m != nil && *m < 1 {
+			err = err.Also(apis.ErrOutOfBoundsValue(*m, 1, math.MaxInt32, "maxConcurrentRollouts"))
+		}
+	default:
+		err = err.Also(apis.ErrInvalidValue(dbs.RolloutPolicy, "rolloutPolicy"))
+	}
+
 	return err
-}
\ No newline at end of file
+}
+
+// Validate implements apis.Validatable
+func (cs *ContainerSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	switch cs.ImagePullPolicy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(cs.ImagePullPolicy, "imagePullPolicy"))
+	}
+
+	res := cs.GetResources()
+	for name, limit := range res.Limits {
+		if req, ok := res.Requests[name]; ok && req.Cmp(limit) > 0 {
+			errs = errs.Also(&apis.FieldError{
+				Message: fmt.Sprintf("request %s must be less than or equal to limit %s", req.String(), limit.String()),
+				Paths:   []string{fmt.Sprintf("resources.requests.%s", name)},
+			})
+		}
+	}
+
+	return errs.Also(validateRestricted(cs.GetSecurityContext()).ViaField("securityContext"))
+}
+
+// Validate implements apis.Validatable
+func (sf *SecretFilesSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	switch sf.Mode {
+	case "", SecretFilesModeOwner, SecretFilesModeGroup:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(sf.Mode, "mode"))
+	}
+	if sf.Owner != nil && *sf.Owner <= 0 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(*sf.Owner, 1, int64(math.MaxInt32), "owner"))
+	}
+	return errs
+}
+
+// MinRenewalInterval is the shortest interval the secrets may be rewritten
+// at, so that the renewers of many subjects don't overwhelm Vault.
+const MinRenewalInterval = 10 * time.Second
+
+// Validate implements apis.Validatable
+func (rs *RenewalSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if i := rs.Interval; i != nil && i.Duration < MinRenewalInterval {
+		errs = errs.Also(&apis.FieldError{
+			Message: fmt.Sprintf("must be at least %v", MinRenewalInterval),
+			Paths:   []string{"interval"},
+		})
+	}
+	if ft := rs.FailureThreshold; ft != nil && *ft < 1 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(*ft, 1, math.MaxInt32, "failureThreshold"))
+	}
+	for i, c := range rs.Command {
+		if c == "" {
+			errs = errs.Also(apis.ErrInvalidArrayValue(c, "command", i))
+		}
+	}
+	if rs.Reload != nil {
+		errs = errs.Also(rs.Reload.Validate(ctx).ViaField("reload"))
+		if rs.Reload.Signal != "" && !rs.ShareProcessNamespace {
+			errs = errs.Also(&apis.FieldError{
+				Message: "signalling a container requires shareProcessNamespace",
+				Paths:   []string{"reload.signal", "shareProcessNamespace"},
+			})
+		}
+	}
+	return errs
+}
+
+// Validate implements apis.Validatable
+func (rs *ReloadSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if rs.Container == "" {
+		errs = errs.Also(apis.ErrMissingField("container"))
+	}
+	switch {
+	case rs.Signal == "" && rs.HTTPPost == nil:
+		errs = errs.Also(apis.ErrMissingOneOf("signal", "httpPost"))
+	case rs.Signal != "" && rs.HTTPPost != nil:
+		errs = errs.Also(apis.ErrMultipleOneOf("signal", "httpPost"))
+	case rs.Signal != "":
+		if _, err := renewal.ParseSignal(rs.Signal); err != nil {
+			errs = errs.Also(&apis.FieldError{
+				Message: err.Error(),
+				Paths:   []string{"signal"},
+			})
+		}
+	default:
+		if p := rs.HTTPPost.Port; p < 1 || p > 65535 {
+			errs = errs.Also(apis.ErrOutOfBoundsValue(p, 1, 65535, "httpPost.port"))
+		}
+		if p := rs.HTTPPost.Path; p != "" && !path.IsAbs(p) {
+			errs = errs.Also(apis.ErrInvalidValue(p, "httpPost.path"))
+		}
+	}
+	return errs
+}
+
+// Validate implements apis.Validatable
+func (vs *VolumeSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	switch vs.Medium {
+	case "", VolumeMediumMemory, VolumeMediumDisk:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(vs.Medium, "medium"))
+	}
+	if vs.SizeLimit != nil && vs.SizeLimit.Sign() <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(vs.SizeLimit.String(), "sizeLimit"))
+	}
+	if vs.MountPath != "" && (!path.IsAbs(vs.MountPath) || strings.Contains(vs.MountPath, ":")) {
+		errs = errs.Also(apis.ErrInvalidValue(vs.MountPath, "mountPath"))
+	}
+	if vs.SubPath != "" && (path.IsAbs(vs.SubPath) || hasDotDot(vs.SubPath)) {
+		errs = errs.Also(apis.ErrInvalidValue(vs.SubPath, "subPath"))
+	}
+	return errs
+}
+
+func hasDotDot(p string) bool {
+	for _, elt := range strings.Split(p, "/") {
+		if elt == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRestricted checks that the provided security context complies with
+// the "restricted" Pod Security Standard.
+func validateRestricted(sc *corev1.SecurityContext) *apis.FieldError {
+	var errs *apis.FieldError
+	notRestricted := func(value interface{}, path string) {
+		errs = errs.Also(&apis.FieldError{
+			Message: fmt.Sprintf("%v is not allowed by the restricted Pod Security Standard", value),
+			Paths:   []string{path},
+		})
+	}
+
+	if sc.Privileged != nil && *sc.Privileged {
+		notRestricted(*sc.Privileged, "privileged")
+	}
+	if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		notRestricted(sc.AllowPrivilegeEscalation, "allowPrivilegeEscalation")
+	}
+	if sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot {
+		notRestricted(sc.RunAsNonRoot, "runAsNonRoot")
+	}
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		notRestricted(*sc.RunAsUser, "runAsUser")
+	}
+	if sc.ProcMount != nil && *sc.ProcMount != corev1.DefaultProcMount {
+		notRestricted(*sc.ProcMount, "procMount")
+	}
+
+	dropsAll := false
+	if sc.Capabilities != nil {
+		for _, c := range sc.Capabilities.Drop {
+			if c == "ALL" {
+				dropsAll = true
+			}
+		}
+		for i, c := range sc.Capabilities.Add {
+			if c != "NET_BIND_SERVICE" {
+				notRestricted(c, fmt.Sprintf("capabilities.add[%d]", i))
+			}
+		}
+	}
+	if !dropsAll {
+		errs = errs.Also(&apis.FieldError{
+			Message: "capabilities must drop ALL to comply with the restricted Pod Security Standard",
+			Paths:   []string{"capabilities.drop"},
+		})
+	}
+	return errs
+}
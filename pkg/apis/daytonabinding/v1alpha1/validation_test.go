@@ -0,0 +1,652 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/ptr"
+	"knative.dev/pkg/tracker"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+)
+
+func TestDaytonaBindingValidation(t *testing.T) {
+	policy := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{
+			AllowedImages: []string{"gcr.io/dangerd-dev"},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		spec    DaytonaBindingSpec
+		wantErr bool
+	}{{
+		name: "valid",
+		ctx:  policy,
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+		},
+	}, {
+		name: "missing image",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+		},
+		wantErr: true,
+	}, {
+		name: "image not allowed",
+		ctx:  policy,
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "docker.io/someone/daytona",
+		},
+		wantErr: true,
+	}, {
+		name: "container overrides",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Container: &ContainerSpec{
+				ImagePullPolicy: corev1.PullAlways,
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("128Mi"),
+					},
+				},
+				SecurityContext: &corev1.SecurityContext{
+					RunAsUser: ptr.Int64(1000),
+				},
+			},
+		},
+	}, {
+		name: "request above limit",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Container: &ContainerSpec{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+				},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "not restricted",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Container: &ContainerSpec{
+				SecurityContext: &corev1.SecurityContext{
+					RunAsUser: ptr.Int64(0),
+					Capabilities: &corev1.Capabilities{
+						Add: []corev1.Capability{"SYS_ADMIN"},
+					},
+				},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "bad volume",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Volume: &VolumeSpec{
+				Medium:    "Tape",
+				MountPath: "relative/path",
+				SubPath:   "../escape",
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "restart owners",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:               podSubject(),
+			Image:                 "gcr.io/dangerd-dev/daytona",
+			RolloutPolicy:         RolloutPolicyRestartOwners,
+			MaxConcurrentRollouts: ptr.Int32(3),
+		},
+	}, {
+		name: "no concurrent rollouts",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:               podSubject(),
+			Image:                 "gcr.io/dangerd-dev/daytona",
+			RolloutPolicy:         RolloutPolicyRestartOwners,
+			MaxConcurrentRollouts: ptr.Int32(0),
+		},
+		wantErr: true,
+	}, {
+		name: "concurrent rollouts without restarts",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:               podSubject(),
+			Image:                 "gcr.io/dangerd-dev/daytona",
+			RolloutPolicy:         RolloutPolicyManual,
+			MaxConcurrentRollouts: ptr.Int32(1),
+		},
+		wantErr: true,
+	}, {
+		name: "bad rollout policy",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:       podSubject(),
+			Image:         "gcr.io/dangerd-dev/daytona",
+			RolloutPolicy: "Sometimes",
+		},
+		wantErr: true,
+	}, {
+		name: "fail open",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:       podSubject(),
+			Image:         "gcr.io/dangerd-dev/daytona",
+			FailurePolicy: FailurePolicyIgnore,
+		},
+	}, {
+		name: "dry run",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:     podSubject(),
+			Image:       "gcr.io/dangerd-dev/daytona",
+			Enforcement: EnforcementDryRun,
+		},
+	}, {
+		name: "bad enforcement",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:     podSubject(),
+			Image:       "gcr.io/dangerd-dev/daytona",
+			Enforcement: "Audit",
+		},
+		wantErr: true,
+	}, {
+		name: "bad failure policy",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:       podSubject(),
+			Image:         "gcr.io/dangerd-dev/daytona",
+			FailurePolicy: "Retry",
+		},
+		wantErr: true,
+	}, {
+		name: "subject in another namespace",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: func() tracker.Reference {
+				s := podSubject()
+				s.Namespace = "kube-system"
+				return s
+			}(),
+			Image: "gcr.io/dangerd-dev/daytona",
+		},
+		wantErr: true,
+	}, {
+		name: "audit sink",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			AuditSink: &duckv1.Destination{
+				Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "audit"},
+				URI: &apis.URL{Path: "/daytona"},
+			},
+		},
+	}, {
+		name: "audit sink uri",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:   podSubject(),
+			Image:     "gcr.io/dangerd-dev/daytona",
+			AuditSink: &duckv1.Destination{URI: apis.HTTP("169.254.169.254")},
+		},
+		wantErr: true,
+	}, {
+		name: "audit sink in another namespace",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			AuditSink: &duckv1.Destination{
+				Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "kube-system", Name: "audit"},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "renewal with a signal",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Interval:              &metav1.Duration{Duration: time.Minute},
+				FailureThreshold:      ptr.Int32(3),
+				ShareProcessNamespace: true,
+				Reload:                &ReloadSpec{Container: "app", Signal: "SIGHUP"},
+			},
+		},
+	}, {
+		name: "renewal with an http reload",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Reload: &ReloadSpec{Container: "app", HTTPPost: &HTTPReload{Port: 8080, Path: "/-/reload"}},
+			},
+		},
+	}, {
+		name: "readiness gate with renewal",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:       podSubject(),
+			Image:         "gcr.io/dangerd-dev/daytona",
+			Renewal:       &RenewalSpec{},
+			ReadinessGate: true,
+		},
+	}, {
+		name: "readiness gate without renewal",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject:       podSubject(),
+			Image:         "gcr.io/dangerd-dev/daytona",
+			ReadinessGate: true,
+		},
+		wantErr: true,
+	}, {
+		name: "renewal too often",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Interval: &metav1.Duration{Duration: time.Second},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "no renewal failures",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				FailureThreshold: ptr.Int32(0),
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "empty renewal command",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Command: []string{"daytona", ""},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "signal without a shared process namespace",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Reload: &ReloadSpec{Container: "app", Signal: "SIGHUP"},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "unsupported signal",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				ShareProcessNamespace: true,
+				Reload:                &ReloadSpec{Container: "app", Signal: "SIGKILL"},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "reload without a container",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Reload: &ReloadSpec{HTTPPost: &HTTPReload{Port: 8080}},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "reload without a method",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Reload: &ReloadSpec{Container: "app"},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "reload with both methods",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				ShareProcessNamespace: true,
+				Reload:                &ReloadSpec{Container: "app", Signal: "SIGHUP", HTTPPost: &HTTPReload{Port: 8080}},
+			},
+		},
+		wantErr: true,
+	}, {
+		name: "bad reload endpoint",
+		ctx:  context.Background(),
+		spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "gcr.io/dangerd-dev/daytona",
+			Renewal: &RenewalSpec{
+				Reload: &ReloadSpec{Container: "app", HTTPPost: &HTTPReload{Port: 0, Path: "reload"}},
+			},
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &DaytonaBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "default"},
+				Spec:       test.spec,
+			}
+			if err := db.Validate(test.ctx); (err != nil) != test.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDaytonaBindingUpdateValidation(t *testing.T) {
+	original := &DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "binding", Namespace: "default"},
+		Spec: DaytonaBindingSpec{
+			Subject:   podSubject(),
+			Image:     "gcr.io/dangerd-dev/daytona",
+			Auth:      "kubernetes",
+			AuthMount: "kubernetes",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		update  func(*DaytonaBinding)
+		wantErr bool
+	}{{
+		name:   "unchanged",
+		update: func(*DaytonaBinding) {},
+	}, {
+		name: "other fields",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Image = "gcr.io/dangerd-dev/daytona:1.3"
+			db.Spec.VaultAuthRole = "other"
+			db.Spec.Subject.Selector.MatchLabels["app"] = "bar"
+		},
+	}, {
+		name: "subject kind",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Subject.APIVersion = "apps/v1"
+			db.Spec.Subject.Kind = "Deployment"
+		},
+		wantErr: true,
+	}, {
+		name: "subject kind with the annotation",
+		update: func(db *DaytonaBinding) {
+			db.Annotations = map[string]string{AllowAuthChangeAnnotation: "true"}
+			db.Spec.Subject.Kind = "Deployment"
+		},
+		wantErr: true,
+	}, {
+		name: "auth method",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Auth = "gcp"
+		},
+		wantErr: true,
+	}, {
+		name: "auth mount",
+		update: func(db *DaytonaBinding) {
+			db.Spec.AuthMount = "kubernetes-prod"
+		},
+		wantErr: true,
+	}, {
+		name: "auth method with the annotation",
+		update: func(db *DaytonaBinding) {
+			db.Annotations = map[string]string{AllowAuthChangeAnnotation: "true"}
+			db.Spec.Auth = "gcp"
+			db.Spec.AuthMount = "gcp"
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := original.DeepCopy()
+			test.update(db)
+			ctx := apis.WithinUpdate(context.Background(), original)
+			if err := db.Validate(ctx); (err != nil) != test.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, test.wantErr)
+			}
+			// Creating the updated binding is always fine.
+			if err := db.Validate(context.Background()); err != nil {
+				t.Errorf("Validate() on create = %v", err)
+			}
+		})
+	}
+}
+
+func TestDaytonaBindingPolicyTightened(t *testing.T) {
+	// The binding was stored before its image was disallowed.
+	original := &DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "binding",
+			Namespace:  "default",
+			Finalizers: []string{"daytonabindings.binding.app"},
+		},
+		Spec: DaytonaBindingSpec{
+			Subject: podSubject(),
+			Image:   "docker.io/someone/daytona",
+		},
+	}
+	policy := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{
+			AllowedImages: []string{"gcr.io/dangerd-dev"},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		update  func(*DaytonaBinding)
+		wantErr bool
+	}{{
+		name: "status update",
+		ctx:  apis.WithinSubResourceUpdate(policy, original, "status"),
+		update: func(db *DaytonaBinding) {
+			db.Status.MarkPolicyDenied(errors.New("not allowed"))
+		},
+	}, {
+		name: "finalizer removal",
+		ctx:  apis.WithinUpdate(policy, original),
+		update: func(db *DaytonaBinding) {
+			db.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			db.Finalizers = nil
+		},
+	}, {
+		name: "metadata update",
+		ctx:  apis.WithinUpdate(policy, original),
+		update: func(db *DaytonaBinding) {
+			db.Labels = map[string]string{"team": "payments"}
+		},
+	}, {
+		name: "image changed",
+		ctx:  apis.WithinUpdate(policy, original),
+		update: func(db *DaytonaBinding) {
+			db.Spec.Image = "docker.io/someone/daytona:1.3"
+		},
+		wantErr: true,
+	}, {
+		name:    "create",
+		ctx:     policy,
+		update:  func(*DaytonaBinding) {},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := original.DeepCopy()
+			test.update(db)
+			if err := db.Validate(test.ctx); (err != nil) != test.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+const testDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestWarnings(t *testing.T) {
+	safe := func() *DaytonaBinding {
+		db := testBinding()
+		db.Spec.Image = "gcr.io/dangerd-dev/daytona@" + testDigest
+		db.Spec.Auth = "true"
+		db.Spec.VaultSecretsApp = "secret/app"
+		return db
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		update func(*DaytonaBinding)
+		want   int
+	}{{
+		name:   "safe",
+		update: func(*DaytonaBinding) {},
+	}, {
+		name: "named subject",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Subject.Selector = nil
+			db.Spec.Subject.Name = "pod"
+		},
+	}, {
+		name: "empty selector",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Subject.Selector = &metav1.LabelSelector{}
+		},
+		want: 1,
+	}, {
+		name: "auth disabled",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Auth = "false"
+		},
+		want: 1,
+	}, {
+		name: "auth disabled without secrets",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Auth = ""
+			db.Spec.VaultSecretsApp = ""
+		},
+	}, {
+		name: "tag",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Image = "gcr.io/dangerd-dev/daytona:1.2"
+		},
+		want: 1,
+	}, {
+		name: "resolved tag",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Image = "gcr.io/dangerd-dev/daytona:1.2"
+			db.Status.ResolvedImage = "gcr.io/dangerd-dev/daytona:1.2@" + testDigest
+		},
+	}, {
+		name: "tag resolved by policy",
+		ctx: config.ToContext(context.Background(), &config.Config{
+			Daytona: &config.Daytona{ResolveImageTags: true},
+		}),
+		update: func(db *DaytonaBinding) {
+			db.Spec.Image = "gcr.io/dangerd-dev/daytona:1.2"
+		},
+	}, {
+		name: "global secrets",
+		update: func(db *DaytonaBinding) {
+			db.Spec.VaultSecretsGlobal = "secret/global"
+		},
+		want: 1,
+	}, {
+		name: "everything",
+		update: func(db *DaytonaBinding) {
+			db.Spec.Subject.Selector = &metav1.LabelSelector{}
+			db.Spec.Auth = ""
+			db.Spec.Image = "gcr.io/dangerd-dev/daytona"
+			db.Spec.VaultSecretsGlobal = "secret/global"
+		},
+		want: 4,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := test.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			db := safe()
+			test.update(db)
+			if got := db.Warnings(ctx); len(got) != test.want {
+				t.Errorf("Warnings() = %q, want %d warnings", got, test.want)
+			}
+		})
+	}
+}
+
+func podSubject() tracker.Reference {
+	return tracker.Reference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  "default",
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "foo"},
+		},
+	}
+}
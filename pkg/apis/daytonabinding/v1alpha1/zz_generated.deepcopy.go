@@ -21,9 +21,40 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	types "k8s.io/apimachinery/pkg/types"
+	apis "knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerSpec) DeepCopyInto(out *ContainerSpec) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerSpec.
+func (in *ContainerSpec) DeepCopy() *ContainerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DaytonaBinding) DeepCopyInto(out *DaytonaBinding) {
 	*out = *in
@@ -89,6 +120,36 @@ func (in *DaytonaBindingList) DeepCopyObject() runtime.Object {
 func (in *DaytonaBindingSpec) DeepCopyInto(out *DaytonaBindingSpec) {
 	*out = *in
 	in.Subject.DeepCopyInto(&out.Subject)
+	if in.Container != nil {
+		in, out := &in.Container, &out.Container
+		*out = new(ContainerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretFiles != nil {
+		in, out := &in.SecretFiles, &out.SecretFiles
+		*out = new(SecretFilesSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Volume != nil {
+		in, out := &in.Volume, &out.Volume
+		*out = new(VolumeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Renewal != nil {
+		in, out := &in.Renewal, &out.Renewal
+		*out = new(RenewalSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxConcurrentRollouts != nil {
+		in, out := &in.MaxConcurrentRollouts, &out.MaxConcurrentRollouts
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AuditSink != nil {
+		in, out := &in.AuditSink, &out.AuditSink
+		*out = new(duckv1.Destination)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -106,6 +167,46 @@ func (in *DaytonaBindingSpec) DeepCopy() *DaytonaBindingSpec {
 func (in *DaytonaBindingStatus) DeepCopyInto(out *DaytonaBindingStatus) {
 	*out = *in
 	in.Status.DeepCopyInto(&out.Status)
+	if in.StaleSubjects != nil {
+		in, out := &in.StaleSubjects, &out.StaleSubjects
+		*out = new(SubjectList)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UnhealthySubjects != nil {
+		in, out := &in.UnhealthySubjects, &out.UnhealthySubjects
+		*out = new(SubjectList)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastSecretVersion != nil {
+		in, out := &in.LastSecretVersion, &out.LastSecretVersion
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SecretsRotatedAt != nil {
+		in, out := &in.SecretsRotatedAt, &out.SecretsRotatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.MatchedSubjects != nil {
+		in, out := &in.MatchedSubjects, &out.MatchedSubjects
+		*out = new(SubjectList)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastInjectionTime != nil {
+		in, out := &in.LastInjectionTime, &out.LastInjectionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.AnnouncedPods != nil {
+		in, out := &in.AnnouncedPods, &out.AnnouncedPods
+		*out = make([]types.UID, len(*in))
+		copy(*out, *in)
+	}
+	if in.AuditSinkURI != nil {
+		in, out := &in.AuditSinkURI, &out.AuditSinkURI
+		*out = new(apis.URL)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -118,3 +219,139 @@ func (in *DaytonaBindingStatus) DeepCopy() *DaytonaBindingStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPReload) DeepCopyInto(out *HTTPReload) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPReload.
+func (in *HTTPReload) DeepCopy() *HTTPReload {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPReload)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReloadSpec) DeepCopyInto(out *ReloadSpec) {
+	*out = *in
+	if in.HTTPPost != nil {
+		in, out := &in.HTTPPost, &out.HTTPPost
+		*out = new(HTTPReload)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReloadSpec.
+func (in *ReloadSpec) DeepCopy() *ReloadSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReloadSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RenewalSpec) DeepCopyInto(out *RenewalSpec) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FailureThreshold != nil {
+		in, out := &in.FailureThreshold, &out.FailureThreshold
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Reload != nil {
+		in, out := &in.Reload, &out.Reload
+		*out = new(ReloadSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RenewalSpec.
+func (in *RenewalSpec) DeepCopy() *RenewalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RenewalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretFilesSpec) DeepCopyInto(out *SecretFilesSpec) {
+	*out = *in
+	if in.Owner != nil {
+		in, out := &in.Owner, &out.Owner
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretFilesSpec.
+func (in *SecretFilesSpec) DeepCopy() *SecretFilesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretFilesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubjectList) DeepCopyInto(out *SubjectList) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubjectList.
+func (in *SubjectList) DeepCopy() *SubjectList {
+	if in == nil {
+		return nil
+	}
+	out := new(SubjectList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeSpec) DeepCopyInto(out *VolumeSpec) {
+	*out = *in
+	if in.SizeLimit != nil {
+		in, out := &in.SizeLimit, &out.SizeLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeSpec.
+func (in *VolumeSpec) DeepCopy() *VolumeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
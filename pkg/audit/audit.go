@@ -0,0 +1,245 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/apis"
+)
+
+const (
+	// EventType is the CloudEvents type of the admission decisions.
+	EventType = "app.binding.daytona.admission"
+
+	// DefaultQueueSize is the number of events that may be waiting to be
+	// delivered to an audit sink, beyond which new events are dropped.
+	DefaultQueueSize = 1000
+
+	// DefaultTimeout bounds the delivery of a single event.
+	DefaultTimeout = 5 * time.Second
+
+	// IdleTimeout is how long the worker of an audit sink waits for
+	// events before it stops.
+	IdleTimeout = time.Minute
+)
+
+// Auditable is implemented by Bindables whose admission decisions are
+// audited.
+type Auditable interface {
+	// AuditSink returns where to post the events, nil when the decisions
+	// aren't audited.
+	AuditSink() *apis.URL
+
+	// AuditVault returns the Vault role the subjects log in as, and the
+	// Vault paths of the secrets they are given.
+	AuditVault() (role string, paths []string)
+}
+
+// Decision is the data of the events.
+type Decision struct {
+	// Subject identifies the admitted object, a Pod or the subject of the
+	// binding itself.
+	Subject Object `json:"subject"`
+
+	// Binding identifies the binding whose subject the object is.
+	Binding Object `json:"binding"`
+
+	// Operation is the admission operation, CREATE or UPDATE.
+	Operation string `json:"operation"`
+
+	// Allowed is whether the object was admitted.
+	Allowed bool `json:"allowed"`
+
+	// Reason is why the object was rejected.
+	Reason string `json:"reason,omitempty"`
+
+	// DryRun is whether the binding only annotated the object with the
+	// injection that would have happened.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Role is the Vault role the object logs in as.
+	Role string `json:"role,omitempty"`
+
+	// SecretPaths are the Vault paths of the secrets the object is given.
+	SecretPaths []string `json:"secretPaths,omitempty"`
+}
+
+// Object identifies a Kubernetes object.
+type Object struct {
+	Kind         string `json:"kind"`
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name,omitempty"`
+	GenerateName string `json:"generateName,omitempty"`
+}
+
+// Event is a CloudEvent carrying an admission decision.
+type Event struct {
+	// ID is unique to the admission request.
+	ID string
+
+	// Source is the path of the binding in the Kubernetes API.
+	Source string
+
+	// Time of the decision.
+	Time time.Time
+
+	// Data is the decision.
+	Data Decision
+}
+
+// Sink delivers events in the background, so that admission never waits on
+// the audit sinks. Each audit sink has its own queue, delivered in order by
+// its own worker, so that a slow sink only holds up its own events.
+type Sink struct {
+	client *http.Client
+	logger *zap.SugaredLogger
+	size   int
+
+	mu sync.Mutex
+	// ctx is the context passed to Run, nil until it is called.
+	ctx    context.Context
+	queues map[string]chan Event
+}
+
+// NewSink returns a Sink holding at most size events per audit sink waiting
+// for delivery. Events are only delivered once Run is called.
+func NewSink(client *http.Client, logger *zap.SugaredLogger, size int) *Sink {
+	return &Sink{
+		client: client,
+		logger: logger,
+		size:   size,
+		queues: make(map[string]chan Event),
+	}
+}
+
+// Send queues the event for delivery to the provided sink.  It never
+// blocks: when the queue of the sink is full the event is dropped, and Send
+// returns false.
+func (s *Sink) Send(sink *apis.URL, event Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sink.String()
+	q, ok := s.queues[key]
+	if !ok {
+		q = make(chan Event, s.size)
+		s.queues[key] = q
+		if s.ctx != nil {
+			go s.work(s.ctx, sink, q)
+		}
+	}
+	select {
+	case q <- event:
+		return true
+	default:
+		s.logger.Warnf("Dropping audit event %s for %s, %d events are waiting", event.ID, sink, cap(q))
+		return false
+	}
+}
+
+// Run delivers the queued events until the context is cancelled.
+func (s *Sink) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	for key, q := range s.queues {
+		sink, err := apis.ParseURL(key)
+		if err != nil {
+			// We queued it from a URL.
+			panic(err)
+		}
+		go s.work(ctx, sink, q)
+	}
+	s.mu.Unlock()
+	<-ctx.Done()
+}
+
+// work delivers the events queued for the sink, one at a time, until the
+// context is cancelled or the sink has been idle for IdleTimeout.
+func (s *Sink) work(ctx context.Context, sink *apis.URL, q chan Event) {
+	idle := time.NewTimer(IdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-q:
+			if err := s.deliver(ctx, sink, event); err != nil {
+				s.logger.Warnw("Failed to deliver audit event "+event.ID, zap.Error(err))
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(IdleTimeout)
+		case <-idle.C:
+			s.mu.Lock()
+			if len(q) == 0 {
+				delete(s.queues, sink.String())
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			idle.Reset(IdleTimeout)
+		}
+	}
+}
+
+// deliver posts the event in the binary content mode of the CloudEvents
+// HTTP protocol binding.
+func (s *Sink) deliver(ctx context.Context, sink *apis.URL, event Event) error {
+	body, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sink.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", event.ID)
+	req.Header.Set("Ce-Type", EventType)
+	req.Header.Set("Ce-Source", event.Source)
+	req.Header.Set("Ce-Subject", event.Data.Subject.Namespace+"/"+name(event.Data.Subject))
+	req.Header.Set("Ce-Time", event.Time.UTC().Format(time.RFC3339Nano))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", sink, resp.Status)
+	}
+	return nil
+}
+
+// name returns the name of the object, or the prefix of the name it will be
+// given when it has none yet.
+func name(o Object) string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.GenerateName
+}
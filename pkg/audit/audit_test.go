@@ -0,0 +1,181 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"knative.dev/pkg/apis"
+)
+
+func TestSink(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   Decision
+	}
+	ch := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ReadAll() = %v", err)
+		}
+		var d Decision
+		if err := json.Unmarshal(b, &d); err != nil {
+			t.Errorf("Unmarshal() = %v", err)
+		}
+		ch <- received{header: r.Header, body: d}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	sink, err := apis.ParseURL(srv.URL)
+	if err != nil {
+		t.Fatalf("ParseURL() = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewSink(srv.Client(), zap.NewNop().Sugar(), 1)
+	go s.Run(ctx)
+
+	decision := Decision{
+		Subject: Object{
+			Kind:         "Pod",
+			Namespace:    "default",
+			GenerateName: "app-5d8f-",
+		},
+		Binding: Object{
+			Kind:      "DaytonaBinding",
+			Namespace: "default",
+			Name:      "binding",
+		},
+		Operation:   "CREATE",
+		Allowed:     true,
+		Role:        "app",
+		SecretPaths: []string{"secret/app"},
+	}
+	at := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	if !s.Send(sink, Event{
+		ID:     "1234",
+		Source: "/apis/binding.app/v1alpha1/namespaces/default/daytonabindings/binding",
+		Time:   at,
+		Data:   decision,
+	}) {
+		t.Fatal("Send() = false, wanted true")
+	}
+
+	select {
+	case got := <-ch:
+		for header, want := range map[string]string{
+			"Content-Type":   "application/json",
+			"Ce-Specversion": "1.0",
+			"Ce-Id":          "1234",
+			"Ce-Type":        EventType,
+			"Ce-Source":      "/apis/binding.app/v1alpha1/namespaces/default/daytonabindings/binding",
+			"Ce-Subject":     "default/app-5d8f-",
+			"Ce-Time":        "2020-04-01T12:00:00Z",
+		} {
+			if got := got.header.Get(header); got != want {
+				t.Errorf("%s = %q, wanted %q", header, got, want)
+			}
+		}
+		if diff := cmp.Diff(decision, got.body); diff != "" {
+			t.Errorf("body (-want, +got) = %s", diff)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the event")
+	}
+}
+
+func TestSinkDrops(t *testing.T) {
+	sink, err := apis.ParseURL("http://audit.example.com")
+	if err != nil {
+		t.Fatalf("ParseURL() = %v", err)
+	}
+
+	// Without Run, nothing leaves the queue.
+	s := NewSink(http.DefaultClient, zap.NewNop().Sugar(), 2)
+	for i, want := range []bool{true, true, false} {
+		if got := s.Send(sink, Event{ID: "dropped"}); got != want {
+			t.Errorf("Send() #%d = %v, wanted %v", i, got, want)
+		}
+	}
+}
+
+func TestSinkIsolatesSinks(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	received := make(chan string, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("Ce-Id")
+	}))
+	defer fast.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewSink(http.DefaultClient, zap.NewNop().Sugar(), 1)
+	go s.Run(ctx)
+
+	for _, d := range []struct {
+		url, id string
+	}{{slow.URL, "slow"}, {fast.URL, "fast"}} {
+		sink, err := apis.ParseURL(d.url)
+		if err != nil {
+			t.Fatalf("ParseURL() = %v", err)
+		}
+		if !s.Send(sink, Event{ID: d.id}) {
+			t.Fatalf("Send(%s) = false, wanted true", d.id)
+		}
+	}
+
+	// The slow sink doesn't hold up the events of the fast one.
+	select {
+	case got := <-received:
+		if got != "fast" {
+			t.Errorf("Received %q, wanted fast", got)
+		}
+	case <-time.After(DefaultTimeout / 2):
+		t.Fatal("Timed out waiting for the event of the fast sink")
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	sink, err := apis.ParseURL(srv.URL)
+	if err != nil {
+		t.Fatalf("ParseURL() = %v", err)
+	}
+
+	s := NewSink(srv.Client(), zap.NewNop().Sugar(), 1)
+	if err := s.deliver(context.Background(), sink, Event{ID: "1234"}); err == nil {
+		t.Error("deliver() = nil, wanted an error")
+	}
+}
@@ -18,6 +18,8 @@ package daytona
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"knative.dev/pkg/ptr"
 )
 
 const (
@@ -27,5 +29,172 @@ const (
 	RunAsUser        = 9999
 	AllowPriv        = false
 	Medium           = corev1.StorageMediumMemory
-	SecretMountPath  = MountPath + "/secrets"   
-)
\ No newline at end of file
+	SecretMountPath  = MountPath + "/secrets"
+
+	// SeccompProfile is the seccomp profile the daytona and renewer
+	// containers run with.
+	SeccompProfile = corev1.SeccompProfileRuntimeDefault
+
+	// AnnotationPrefix is the prefix of the annotations we put on Pods.
+	AnnotationPrefix = "daytona.binding.app/"
+
+	// InjectedAnnotation records the namespace/name of the DaytonaBinding
+	// that injected Daytona into a Pod.
+	InjectedAnnotation = AnnotationPrefix + "binding"
+
+	// GenerationAnnotation records the generation of the DaytonaBinding
+	// that injected Daytona into a Pod.
+	GenerationAnnotation = AnnotationPrefix + "generation"
+
+	// ConfigHashAnnotation records the hash of the effective configuration
+	// injected into a Pod.
+	ConfigHashAnnotation = AnnotationPrefix + "config-hash"
+
+	// ImageAnnotation records the daytona image injected into a Pod.
+	ImageAnnotation = AnnotationPrefix + "image"
+
+	// FSGroupAnnotation records the fsGroup we set on a Pod, so that we
+	// only ever remove an fsGroup we own.
+	FSGroupAnnotation = AnnotationPrefix + "fs-group"
+
+	// RestartedAtAnnotation is set on the Pod template of a workload we
+	// restart, recording when we did so.
+	RestartedAtAnnotation = AnnotationPrefix + "restartedAt"
+
+	// RestartedForAnnotation is set on the Pod template of a workload we
+	// restart, recording the config hash, and secret rotation, the restart
+	// rolls out.
+	RestartedForAnnotation = AnnotationPrefix + "restartedFor"
+
+	// DryRunAnnotation describes, as a JSON DryRun, the injection a
+	// binding in DryRun would have made to a Pod.
+	DryRunAnnotation = AnnotationPrefix + "dry-run"
+)
+
+// DryRun describes the injection a binding in DryRun would have made.
+type DryRun struct {
+	// Binding is the namespace/name of the binding.
+	Binding string `json:"binding"`
+
+	// Image is the daytona image that would have been injected.
+	Image string `json:"image,omitempty"`
+
+	// Role is the Vault role daytona would have logged in as.
+	Role string `json:"role,omitempty"`
+
+	// SecretPaths are the Vault paths daytona would have read.
+	SecretPaths []string `json:"secretPaths,omitempty"`
+
+	// Denied is why the Pod would have been rejected, if it would have.
+	Denied string `json:"denied,omitempty"`
+}
+
+// SecretsReadyCondition is the readiness gate a Pod is injected with when
+// its binding asks for it, which is only True once daytona delivered the
+// secrets, and while the renewer keeps them up to date.
+const SecretsReadyCondition corev1.PodConditionType = AnnotationPrefix + "secrets-ready"
+
+const (
+	// RenewerContainerName is the name of the sidecar that runs daytona
+	// again and again to keep the secrets up to date.
+	RenewerContainerName = "daytona-renewer"
+
+	// RenewerInstallContainerName is the name of the init container that
+	// installs the renewer binary for the sidecar to run.
+	RenewerInstallContainerName = "daytona-renewer-install"
+
+	// RenewerVolumeName is the name of the volume holding the renewer
+	// binary and its ready file.
+	RenewerVolumeName = "daytona-renewer"
+
+	// RenewerMountPath is where the renewer volume is mounted.
+	RenewerMountPath = "/daytona-renewer"
+
+	// RenewerBinary is the path of the renewer binary in the sidecar.
+	RenewerBinary = RenewerMountPath + "/renewer"
+
+	// RenewerReadyFile exists while the renewer keeps the secrets up to
+	// date, which the readiness probe of the sidecar checks.
+	RenewerReadyFile = RenewerMountPath + "/ready"
+
+	// ReloadTargetEnv is set to its own name on the container the renewer
+	// signals, so that the renewer can tell its processes apart.
+	ReloadTargetEnv = "DAYTONA_RELOAD_TARGET"
+
+	// ShareProcessNamespaceAnnotation records that we enabled
+	// shareProcessNamespace on a Pod, so that we only ever disable what we
+	// enabled.
+	ShareProcessNamespaceAnnotation = AnnotationPrefix + "share-process-namespace"
+)
+
+// DefaultSecurityContext returns the security context of the daytona
+// container, which complies with the "restricted" Pod Security Standard.
+func DefaultSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		RunAsUser:                ptr.Int64(RunAsUser),
+		RunAsNonRoot:             ptr.Bool(true),
+		AllowPrivilegeEscalation: ptr.Bool(AllowPriv),
+		ReadOnlyRootFilesystem:   ptr.Bool(true),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
+}
+
+// DefaultResources returns the resource requests and limits of the daytona
+// container, so that it is admitted in namespaces enforcing a ResourceQuota.
+func DefaultResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+}
+
+// ContainerStatus returns the status of the daytona init container of the
+// Pod, or nil when it has none yet.
+func ContainerStatus(pod *corev1.Pod) *corev1.ContainerStatus {
+	for i, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name == ContainerName {
+			return &pod.Status.InitContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// RenewerStatus returns the status of the renewer sidecar of the Pod, or
+// nil when it has none yet.
+func RenewerStatus(pod *corev1.Pod) *corev1.ContainerStatus {
+	for i, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == RenewerContainerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// Failure returns the termination of the last run of the daytona init
+// container of the Pod when it failed, or nil when it hasn't failed or has
+// succeeded since.
+func Failure(pod *corev1.Pod) *corev1.ContainerStateTerminated {
+	cs := ContainerStatus(pod)
+	if cs == nil {
+		return nil
+	}
+	if t := cs.State.Terminated; t != nil {
+		if t.ExitCode == 0 {
+			return nil
+		}
+		return t
+	}
+	// daytona is waiting to be, or being, retried after a failure.
+	if lt := cs.LastTerminationState.Terminated; lt != nil && lt.ExitCode != 0 {
+		return lt
+	}
+	return nil
+}
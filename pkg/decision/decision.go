@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package decision lets the Do and Undo methods of a Bindable record their
+// verdict about the subject being admitted, without the API types depending
+// on the admission controller that acts on it.
+package decision
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"knative.dev/pkg/kmeta"
+)
+
+// Decision accumulates the verdicts recorded by Do/Undo while a single
+// admission request is being processed.
+type Decision struct {
+	mu       sync.Mutex
+	denials  []string
+	warnings []string
+
+	// binding is the binding whose Do or Undo handled the subject being
+	// admitted, if any.
+	binding kmeta.Accessor
+}
+
+type decisionKey struct{}
+
+// With returns a context in which the verdicts recorded by Deny, Warn and
+// Handled are accumulated in the returned Decision.
+func With(ctx context.Context) (context.Context, *Decision) {
+	d := &Decision{}
+	return context.WithValue(ctx, decisionKey{}, d), d
+}
+
+// From returns the Decision accumulated in the provided context, if any.
+func From(ctx context.Context) (*Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(*Decision)
+	return d, ok
+}
+
+// Deny records that the admission request being processed with this context
+// must be rejected for the provided reason.  Outside of admission, e.g. when
+// the reconciler invokes Do on existing subjects, this is a no-op.
+func Deny(ctx context.Context, format string, args ...interface{}) {
+	d, ok := From(ctx)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.denials = append(d.denials, fmt.Sprintf(format, args...))
+}
+
+// Warn records a warning about the admission request being processed with
+// this context, which does not prevent the request from being admitted.
+// Outside of admission this is a no-op.
+func Warn(ctx context.Context, format string, args ...interface{}) {
+	d, ok := From(ctx)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.warnings = append(d.warnings, fmt.Sprintf(format, args...))
+}
+
+// Handled records that the provided binding is the one handling the subject
+// being admitted with this context, so that the admission request is
+// attributed to it in the metrics and audit events.  Do and Undo call it
+// first thing.  Outside of admission this is a no-op.
+func Handled(ctx context.Context, b kmeta.Accessor) {
+	d, ok := From(ctx)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.binding = b
+}
+
+// Denials returns the reasons recorded by Deny.
+func (d *Decision) Denials() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.denials
+}
+
+// Warnings returns the warnings recorded by Warn.
+func (d *Decision) Warnings() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.warnings
+}
+
+// Binding returns the binding recorded by Handled, if any.
+func (d *Decision) Binding() kmeta.Accessor {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.binding
+}
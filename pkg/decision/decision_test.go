@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	duckv1alpha1 "knative.dev/pkg/apis/duck/v1alpha1"
+	"knative.dev/pkg/kmeta"
+)
+
+func TestDecision(t *testing.T) {
+	b := &duckv1alpha1.Binding{ObjectMeta: metav1.ObjectMeta{Name: "binding"}}
+
+	// Outside of admission these must be no-ops.
+	Deny(context.Background(), "nope")
+	Warn(context.Background(), "careful")
+	Handled(context.Background(), b)
+
+	if _, ok := From(context.Background()); ok {
+		t.Error("From() found a Decision outside of admission")
+	}
+	ctx, d := With(context.Background())
+	if got, ok := From(ctx); !ok || got != d {
+		t.Errorf("From() = %v, %v, wanted %v", got, ok, d)
+	}
+	if d.Binding() != nil {
+		t.Errorf("Binding() = %v, wanted none before Handled", d.Binding())
+	}
+	Handled(ctx, b)
+	Deny(ctx, "denied %d", 1)
+	Warn(ctx, "warned %d", 1)
+	Warn(ctx, "warned %d", 2)
+
+	if diff := cmp.Diff([]string{"denied 1"}, d.Denials()); diff != "" {
+		t.Errorf("Denials (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff([]string{"warned 1", "warned 2"}, d.Warnings()); diff != "" {
+		t.Errorf("Warnings (-want, +got) = %s", diff)
+	}
+	if d.Binding() != kmeta.Accessor(b) {
+		t.Errorf("Binding() = %v, wanted %v", d.Binding(), b)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/apis"
+	pkgmetrics "knative.dev/pkg/metrics"
+)
+
+const (
+	// MaxNamespaces is the number of distinct namespaces we tag metrics
+	// with, the metrics of the bindings in any other namespace are tagged
+	// with OtherValue.
+	MaxNamespaces = 50
+
+	// MaxBindings is the number of distinct bindings we tag metrics with,
+	// the metrics of any other binding are tagged with OtherValue.
+	MaxBindings = 200
+
+	// OtherValue is the value of the tags over their cardinality limit.
+	OtherValue = "other"
+)
+
+var (
+	podsMutatedM = stats.Int64(
+		"pods_mutated_count",
+		"The number of subjects mutated by a binding at admission",
+		stats.UnitDimensionless)
+	podsDryRunM = stats.Int64(
+		"pods_dry_run_count",
+		"The number of subjects annotated by a binding in DryRun at admission",
+		stats.UnitDimensionless)
+	mutationErrorsM = stats.Int64(
+		"mutation_error_count",
+		"The number of admission requests a binding failed to mutate or rejected",
+		stats.UnitDimensionless)
+	admissionLatencyM = stats.Float64(
+		"admission_latencies",
+		"The time taken to admit the subjects of bindings in milliseconds",
+		stats.UnitMilliseconds)
+	reconcileCountM = stats.Int64(
+		"reconcile_condition_count",
+		"The number of reconciliations of bindings, by the resulting conditions",
+		stats.UnitDimensionless)
+	staleSubjectsM = stats.Int64(
+		"stale_subjects",
+		"The number of subjects running with an outdated injection",
+		stats.UnitDimensionless)
+
+	// Create the tag keys that will be used to add tags to our measurements.
+	namespaceKey       = tag.MustNewKey("namespace_name")
+	bindingKey         = tag.MustNewKey("binding_name")
+	allowedKey         = tag.MustNewKey("admission_allowed")
+	conditionTypeKey   = tag.MustNewKey("condition_type")
+	conditionStatusKey = tag.MustNewKey("condition_status")
+	conditionReasonKey = tag.MustNewKey("condition_reason")
+
+	namespaces = &limiter{max: MaxNamespaces}
+	bindings   = &limiter{max: MaxBindings}
+)
+
+func init() {
+	bindingTags := []tag.Key{namespaceKey, bindingKey}
+	if err := view.Register(
+		&view.View{
+			Description: podsMutatedM.Description(),
+			Measure:     podsMutatedM,
+			Aggregation: view.Count(),
+			TagKeys:     bindingTags,
+		},
+		&view.View{
+			Description: podsDryRunM.Description(),
+			Measure:     podsDryRunM,
+			Aggregation: view.Count(),
+			TagKeys:     bindingTags,
+		},
+		&view.View{
+			Description: mutationErrorsM.Description(),
+			Measure:     mutationErrorsM,
+			Aggregation: view.Count(),
+			TagKeys:     bindingTags,
+		},
+		&view.View{
+			Description: admissionLatencyM.Description(),
+			Measure:     admissionLatencyM,
+			Aggregation: view.Distribution(pkgmetrics.Buckets125(1, 10000)...), // [1 2 5 10 20 50 100 200 500 1000 2000 5000 10000]ms
+			TagKeys:     []tag.Key{allowedKey},
+		},
+		&view.View{
+			Description: reconcileCountM.Description(),
+			Measure:     reconcileCountM,
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{conditionTypeKey, conditionStatusKey, conditionReasonKey},
+		},
+		&view.View{
+			Description: staleSubjectsM.Description(),
+			Measure:     staleSubjectsM,
+			Aggregation: view.LastValue(),
+			TagKeys:     bindingTags,
+		},
+	); err != nil {
+		panic(err)
+	}
+}
+
+// limiter caps the number of distinct values of a tag, so that a cluster
+// with many bindings doesn't overwhelm the metrics backend.
+type limiter struct {
+	sync.Mutex
+	max  int
+	seen sets.String
+}
+
+// value returns the provided value if it is one of the first max distinct
+// values we've been asked for, and OtherValue otherwise.
+func (l *limiter) value(v string) string {
+	l.Lock()
+	defer l.Unlock()
+	if l.seen == nil {
+		l.seen = sets.NewString()
+	}
+	if !l.seen.Has(v) {
+		if l.seen.Len() >= l.max {
+			return OtherValue
+		}
+		l.seen.Insert(v)
+	}
+	return v
+}
+
+func bindingContext(ctx context.Context, namespace, name string) (context.Context, error) {
+	name = bindings.value(namespace + "/" + name)
+	if name != OtherValue {
+		name = name[len(namespace)+1:]
+	}
+	return tag.New(ctx,
+		tag.Insert(namespaceKey, namespaces.value(namespace)),
+		tag.Insert(bindingKey, name))
+}
+
+// ReportMutation records that the named binding mutated a subject at
+// admission, or failed to.
+func ReportMutation(ctx context.Context, namespace, name string, allowed bool) error {
+	ctx, err := bindingContext(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		pkgmetrics.Record(ctx, podsMutatedM.M(1))
+	} else {
+		pkgmetrics.Record(ctx, mutationErrorsM.M(1))
+	}
+	return nil
+}
+
+// ReportDryRun records that the named binding, in DryRun, annotated a
+// subject at admission with the injection that would have happened.
+func ReportDryRun(ctx context.Context, namespace, name string) error {
+	ctx, err := bindingContext(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	pkgmetrics.Record(ctx, podsDryRunM.M(1))
+	return nil
+}
+
+// ReportAdmission records the time it took to admit, or reject, a subject.
+func ReportAdmission(ctx context.Context, allowed bool, d time.Duration) error {
+	ctx, err := tag.New(ctx, tag.Insert(allowedKey, strconv.FormatBool(allowed)))
+	if err != nil {
+		return err
+	}
+	// Convert time.Duration in nanoseconds to milliseconds
+	pkgmetrics.Record(ctx, admissionLatencyM.M(float64(d)/float64(time.Millisecond)))
+	return nil
+}
+
+// ReportReconcile records the conditions a binding was left in by a
+// reconciliation, along with the number of its stale subjects.
+func ReportReconcile(ctx context.Context, namespace, name string, conds []apis.Condition, stale int32) error {
+	for _, cond := range conds {
+		cctx, err := tag.New(ctx,
+			tag.Insert(conditionTypeKey, string(cond.Type)),
+			tag.Insert(conditionStatusKey, string(cond.Status)),
+			tag.Insert(conditionReasonKey, cond.Reason))
+		if err != nil {
+			return err
+		}
+		pkgmetrics.Record(cctx, reconcileCountM.M(1))
+	}
+
+	ctx, err := bindingContext(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	pkgmetrics.Record(ctx, staleSubjectsM.M(int64(stale)))
+	return nil
+}
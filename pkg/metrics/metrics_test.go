@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
+)
+
+// rows returns the rows of the named view, keyed by their tags.
+func rows(t *testing.T, name string) map[string]view.AggregationData {
+	t.Helper()
+	rs, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatalf("RetrieveData(%s) = %v", name, err)
+	}
+	m := make(map[string]view.AggregationData, len(rs))
+	for _, r := range rs {
+		m[fmt.Sprint(tagMap(r.Tags))] = r.Data
+	}
+	return m
+}
+
+func tagMap(tags []tag.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[t.Key.Name()] = t.Value
+	}
+	return m
+}
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{max: 2}
+	for _, test := range []struct {
+		value, want string
+	}{
+		{"a", "a"},
+		{"b", "b"},
+		{"c", OtherValue},
+		{"a", "a"},
+		{"b", "b"},
+		{"d", OtherValue},
+	} {
+		if got := l.value(test.value); got != test.want {
+			t.Errorf("value(%q) = %q, wanted %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestReportMutation(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := ReportMutation(ctx, "mutation", "foo", true); err != nil {
+			t.Fatalf("ReportMutation() = %v", err)
+		}
+	}
+	if err := ReportMutation(ctx, "mutation", "foo", false); err != nil {
+		t.Fatalf("ReportMutation() = %v", err)
+	}
+
+	key := fmt.Sprint(map[string]string{"namespace_name": "mutation", "binding_name": "foo"})
+	if got, ok := rows(t, "pods_mutated_count")[key].(*view.CountData); !ok || got.Value != 3 {
+		t.Errorf("pods_mutated_count = %v, wanted 3", got)
+	}
+	if got, ok := rows(t, "mutation_error_count")[key].(*view.CountData); !ok || got.Value != 1 {
+		t.Errorf("mutation_error_count = %v, wanted 1", got)
+	}
+}
+
+func TestReportDryRun(t *testing.T) {
+	if err := ReportDryRun(context.Background(), "dry-run", "foo"); err != nil {
+		t.Fatalf("ReportDryRun() = %v", err)
+	}
+
+	key := fmt.Sprint(map[string]string{"namespace_name": "dry-run", "binding_name": "foo"})
+	if got, ok := rows(t, "pods_dry_run_count")[key].(*view.CountData); !ok || got.Value != 1 {
+		t.Errorf("pods_dry_run_count = %v, wanted 1", got)
+	}
+}
+
+func TestReportAdmission(t *testing.T) {
+	if err := ReportAdmission(context.Background(), true, 30*time.Millisecond); err != nil {
+		t.Fatalf("ReportAdmission() = %v", err)
+	}
+
+	key := fmt.Sprint(map[string]string{"admission_allowed": "true"})
+	got, ok := rows(t, "admission_latencies")[key].(*view.DistributionData)
+	if !ok || got.Count != 1 || got.Max != 30 {
+		t.Errorf("admission_latencies = %v, wanted a single 30ms sample", got)
+	}
+}
+
+func TestReportReconcile(t *testing.T) {
+	conds := []apis.Condition{{
+		Type:   apis.ConditionReady,
+		Status: corev1.ConditionTrue,
+	}, {
+		Type:   "SubjectsUpToDate",
+		Status: corev1.ConditionFalse,
+		Reason: "StaleSubjects",
+	}}
+	if err := ReportReconcile(context.Background(), "reconcile", "foo", conds, 3); err != nil {
+		t.Fatalf("ReportReconcile() = %v", err)
+	}
+	if err := ReportReconcile(context.Background(), "reconcile", "foo", conds[:1], 0); err != nil {
+		t.Fatalf("ReportReconcile() = %v", err)
+	}
+
+	counts := rows(t, "reconcile_condition_count")
+	for key, want := range map[string]int64{
+		// Empty tag values are dropped.
+		fmt.Sprint(map[string]string{"condition_type": "Ready", "condition_status": "True"}):                                                  2,
+		fmt.Sprint(map[string]string{"condition_type": "SubjectsUpToDate", "condition_status": "False", "condition_reason": "StaleSubjects"}): 1,
+	} {
+		if got, ok := counts[key].(*view.CountData); !ok || got.Value != want {
+			t.Errorf("reconcile_condition_count%s = %v, wanted %d", key, got, want)
+		}
+	}
+
+	key := fmt.Sprint(map[string]string{"namespace_name": "reconcile", "binding_name": "foo"})
+	if got, ok := rows(t, "stale_subjects")[key].(*view.LastValueData); !ok || got.Value != 0 {
+		t.Errorf("stale_subjects = %v, wanted 0", got)
+	}
+}
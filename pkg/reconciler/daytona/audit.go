@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/apis/duck"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/tracker"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+)
+
+// reconcileAuditSink resolves the binding's audit sink, which the webhook
+// reads from its status.  An audit sink that doesn't resolve doesn't hold up
+// the binding, its subjects are then admitted without being audited.
+func (r *Reconciler) reconcileAuditSink(ctx context.Context, db *v1alpha1.DaytonaBinding) {
+	if db.Spec.AuditSink == nil {
+		db.Status.ClearAuditSink()
+		return
+	}
+
+	uri, err := r.resolveSink(*db.Spec.AuditSink, db)
+	if err != nil {
+		if db.Status.AuditSinkURI != nil {
+			r.Recorder.Eventf(db, corev1.EventTypeWarning, "AuditSinkUnresolved",
+				"Failed to resolve the audit sink, admission decisions are no longer audited: %v", err)
+		}
+		db.Status.MarkAuditSinkUnresolved("AuditSinkUnresolved", "Failed to resolve the audit sink: %v", err)
+		return
+	}
+	db.Status.MarkAuditSink(uri)
+}
+
+// sinkResolver resolves Destinations into URLs, tracking the Addressables
+// they refer to.  It mirrors knative.dev/pkg/resolver, which we can't use as
+// it pulls in an HTTP/2 server we don't vendor.
+type sinkResolver struct {
+	tracker tracker.Interface
+	factory duck.InformerFactory
+}
+
+// resolve implements the resolveSink field of Reconciler. Validation keeps
+// the audit sinks in the namespace of their binding, but not those stored
+// before it did, so the destination must refer to the parent's namespace.
+func (sr *sinkResolver) resolve(dest duckv1.Destination, parent interface{}) (*apis.URL, error) {
+	if dest.Ref == nil {
+		return nil, errors.New("destination has no ref")
+	}
+	if p, ok := parent.(metav1.Object); !ok || dest.Ref.Namespace != p.GetNamespace() {
+		return nil, fmt.Errorf("%s %s/%s isn't in the binding's namespace", dest.Ref.Kind, dest.Ref.Namespace, dest.Ref.Name)
+	}
+	if dest.URI != nil && (dest.URI.Scheme != "" || dest.URI.Host != "") {
+		return nil, errors.New("destination URI must be a path relative to its ref")
+	}
+
+	url, err := sr.resolveRef(dest.Ref, parent)
+	if err != nil {
+		return nil, err
+	}
+	if dest.URI != nil {
+		return url.ResolveReference(dest.URI), nil
+	}
+	return url, nil
+}
+
+func (sr *sinkResolver) resolveRef(ref *corev1.ObjectReference, parent interface{}) (*apis.URL, error) {
+	if err := sr.tracker.Track(*ref, parent); err != nil {
+		return nil, fmt.Errorf("failed to track %s %s/%s: %w", ref.Kind, ref.Namespace, ref.Name, err)
+	}
+
+	// Services aren't Addressable, but can be called.
+	if ref.APIVersion == "v1" && ref.Kind == "Service" {
+		return &apis.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s.%s.svc", ref.Name, ref.Namespace),
+			Path:   "/",
+		}, nil
+	}
+
+	gvr, _ := meta.UnsafeGuessKindToResource(ref.GroupVersionKind())
+	_, lister, err := sr.factory.Get(gvr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lister for %v: %w", gvr, err)
+	}
+	obj, err := lister.ByNamespace(ref.Namespace).Get(ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	addressable, ok := obj.(*duckv1.AddressableType)
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s is not Addressable", ref.Kind, ref.Namespace, ref.Name)
+	}
+	if addressable.Status.Address == nil || addressable.Status.Address.URL == nil ||
+		addressable.Status.Address.URL.Host == "" {
+		return nil, fmt.Errorf("%s %s/%s has no address", ref.Kind, ref.Namespace, ref.Name)
+	}
+	return addressable.Status.Address.URL, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+)
+
+func TestReconcileAuditSink(t *testing.T) {
+	sink := apis.HTTP("audit.example.com")
+	var resolveErr error
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{Recorder: recorder},
+		resolveSink: func(duckv1.Destination, interface{}) (*apis.URL, error) {
+			return sink, resolveErr
+		},
+	}
+
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+	}
+	db.Status.InitializeConditions()
+	db.Status.MarkSpecValid()
+	db.Status.MarkBindingAvailable()
+	db.Status.MarkProfileResolved()
+	db.Status.MarkPolicyAllowed()
+	db.Status.MarkWebhookProgrammed()
+	db.Status.MarkUnhealthySubjects(nil)
+
+	r.reconcileAuditSink(context.Background(), db)
+	if db.Status.AuditSinkURI != nil || db.Status.GetCondition(v1alpha1.DaytonaBindingConditionAuditSinkResolved) != nil {
+		t.Errorf("Without an audit sink, got %v and %v", db.Status.AuditSinkURI,
+			db.Status.GetCondition(v1alpha1.DaytonaBindingConditionAuditSinkResolved))
+	}
+
+	db.Spec.AuditSink = &duckv1.Destination{
+		Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "audit"},
+	}
+	r.reconcileAuditSink(context.Background(), db)
+	if got := db.Status.AuditSinkURI; got == nil || got.String() != sink.String() {
+		t.Errorf("AuditSinkURI = %v, wanted %v", got, sink)
+	}
+	if cond := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionAuditSinkResolved); cond == nil || !cond.IsTrue() {
+		t.Errorf("AuditSinkResolved = %v, wanted True", cond)
+	}
+	resolveErr = errors.New("boom")
+	r.reconcileAuditSink(context.Background(), db)
+	if db.Status.AuditSinkURI != nil {
+		t.Errorf("AuditSinkURI = %v, wanted nil", db.Status.AuditSinkURI)
+	}
+	if cond := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionAuditSinkResolved); cond == nil || !cond.IsFalse() {
+		t.Errorf("AuditSinkResolved = %v, wanted False", cond)
+	}
+	if cond := db.Status.GetCondition(apis.ConditionReady); cond == nil || !cond.IsTrue() {
+		t.Errorf("Ready = %v, the audit sink must not affect readiness", cond)
+	}
+	if got := len(events(recorder)); got != 1 {
+		t.Errorf("Got %d events, wanted one", got)
+	}
+}
+
+func TestSinkResolver(t *testing.T) {
+	sr := &sinkResolver{tracker: tracker.New(func(types.NamespacedName) {}, 0)}
+	parent := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+	}
+
+	for _, test := range []struct {
+		name    string
+		dest    duckv1.Destination
+		want    string
+		wantErr bool
+	}{{
+		name:    "uri",
+		dest:    duckv1.Destination{URI: apis.HTTP("audit.example.com")},
+		wantErr: true,
+	}, {
+		name: "service",
+		dest: duckv1.Destination{
+			Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "audit"},
+		},
+		want: "http://audit.default.svc/",
+	}, {
+		name: "service with path",
+		dest: duckv1.Destination{
+			Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "audit"},
+			URI: &apis.URL{Path: "/daytona"},
+		},
+		want: "http://audit.default.svc/daytona",
+	}, {
+		name: "service with absolute uri",
+		dest: duckv1.Destination{
+			Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "audit"},
+			URI: apis.HTTP("metadata.internal"),
+		},
+		wantErr: true,
+	}, {
+		name: "another namespace",
+		dest: duckv1.Destination{
+			Ref: &corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "kube-system", Name: "audit"},
+		},
+		wantErr: true,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := sr.resolve(test.dest, parent)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("resolve() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && got.String() != test.want {
+				t.Errorf("resolve() = %s, wanted %s", got, test.want)
+			}
+		})
+	}
+}
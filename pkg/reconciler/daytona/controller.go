@@ -18,13 +18,28 @@ package daytona
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
 
 	dbinformer "github.com/dgerd/daytona-binding/pkg/client/injection/informers/daytonabinding/v1alpha1/daytonabinding"
+	"knative.dev/pkg/client/injection/ducks/duck/v1/addressable"
 	"knative.dev/pkg/client/injection/ducks/duck/v1/podable"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	mwhinformer "knative.dev/pkg/client/injection/kube/informers/admissionregistration/v1beta1/mutatingwebhookconfiguration"
+	daemonsetinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/daemonset"
+	deploymentinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/deployment"
+	replicasetinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/replicaset"
+	statefulsetinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/statefulset"
+	podinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/pod"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"knative.dev/pkg/apis/duck"
@@ -32,16 +47,32 @@ import (
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/injection/clients/dynamicclient"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
 	"knative.dev/pkg/tracker"
 	"knative.dev/pkg/webhook/podbinding"
 
+	"github.com/dgerd/daytona-binding/pkg/admission"
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
 	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	versionedscheme "github.com/dgerd/daytona-binding/pkg/client/clientset/versioned/scheme"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+	"github.com/dgerd/daytona-binding/pkg/registry"
+	"github.com/dgerd/daytona-binding/pkg/vault"
 )
 
 const (
 	controllerAgentName = "daytona-controller"
+
+	// serviceAccountTokenPath is where the token of our service account is
+	// mounted.
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 )
 
+func init() {
+	// Have Events refer to our bindings.
+	versionedscheme.AddToScheme(scheme.Scheme)
+}
+
 // NewController returns a new DaytonaBinding reconciler. This reconciler tracks changes on the
 // DaytonaBinding CRD object to ensure the webhook is targeting the current tracked resources and
 // that the latest configuration options are being applied.
@@ -53,23 +84,88 @@ func NewController(
 
 	dbInformer := dbinformer.Get(ctx)
 	dc := dynamicclient.Get(ctx)
+	kc := kubeclient.Get(ctx)
 	podInformerFactory := podable.Get(ctx)
+	deploymentInformer := deploymentinformer.Get(ctx)
+	replicaSetInformer := replicasetinformer.Get(ctx)
+	statefulSetInformer := statefulsetinformer.Get(ctx)
+	daemonSetInformer := daemonsetinformer.Get(ctx)
+	podInformer := podinformer.Get(ctx)
+	mwhInformer := mwhinformer.Get(ctx)
+
+	store := config.NewStore(logger.Named("config-store"))
+	store.WatchConfigs(cmw)
 
-	c := &podbinding.BaseReconciler{
-		GVR: v1alpha1.SchemeGroupVersion.WithResource("daytonabindings"),
-		Get: func(namespace string, name string) (podbinding.Bindable, error) {
-			return dbInformer.Lister().DaytonaBindings(namespace).Get(name)
+	c := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{
+			GVR: v1alpha1.SchemeGroupVersion.WithResource("daytonabindings"),
+			Get: func(namespace string, name string) (podbinding.Bindable, error) {
+				return dbInformer.Lister().DaytonaBindings(namespace).Get(name)
+			},
+			DynamicClient: dc,
+			Recorder:      newRecorder(ctx),
+		},
+		Resolver:          registry.NewResolver(&http.Client{Timeout: registry.DefaultTimeout}),
+		DeploymentLister:  deploymentInformer.Lister(),
+		ReplicaSetLister:  replicaSetInformer.Lister(),
+		StatefulSetLister: statefulSetInformer.Lister(),
+		DaemonSetLister:   daemonSetInformer.Lister(),
+		PodLister:         podInformer.Lister(),
+		MWHLister:         mwhInformer.Lister(),
+		labelsNamespaces: func() (bool, error) {
+			return admission.LabelsNamespaces(kc.Discovery())
+		},
+		NewVault: func(address string) vault.Client {
+			return vault.NewClient(address, &http.Client{Timeout: vault.DefaultTimeout})
+		},
+		serviceAccountToken: func(namespace, name string) (string, error) {
+			tr, err := kc.CoreV1().ServiceAccounts(namespace).CreateToken(name, &authenticationv1.TokenRequest{
+				Spec: authenticationv1.TokenRequestSpec{
+					ExpirationSeconds: ptr.Int64(600),
+				},
+			})
+			if err != nil {
+				return "", err
+			}
+			return tr.Status.Token, nil
+		},
+		controllerToken: func() (string, error) {
+			b, err := ioutil.ReadFile(serviceAccountTokenPath)
+			return string(b), err
 		},
-		DynamicClient: dc,
-		Recorder: record.NewBroadcaster().NewRecorder(
-			scheme.Scheme, corev1.EventSource{Component: controllerAgentName}),
+		configStore: store,
 	}
 	impl := controller.NewImpl(c, logger, "DaytonaBindings")
+	c.enqueueAfter = impl.EnqueueAfter
 
 	logger.Info("Setting up event handlers")
 
 	dbInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
 
+	// Whenever a Pod we injected changes, e.g. its daytona container fails,
+	// the health of its binding might change, and whenever a Pod annotated
+	// by a binding in DryRun comes or goes, its count of matched Pods does.
+	podInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			_, ok := boundBy(obj)
+			return ok
+		},
+		Handler: controller.HandleAll(func(obj interface{}) {
+			if key, ok := boundBy(obj); ok {
+				impl.EnqueueKey(key)
+			}
+		}),
+	})
+
+	// Whenever the webhook programs its configuration, the bindings whose
+	// subjects it now intercepts, or no longer does, must be marked so.
+	mwhInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: controller.FilterWithName(webhookName),
+		Handler: controller.HandleAll(func(interface{}) {
+			impl.GlobalResync(dbInformer.Informer())
+		}),
+	})
+
 	c.Tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
 	c.Factory = &duck.CachedInformerFactory{
 		Delegate: &duck.EnqueueInformerFactory{
@@ -78,9 +174,77 @@ func NewController(
 		},
 	}
 
+	sr := &sinkResolver{
+		tracker: c.Tracker,
+		factory: &duck.CachedInformerFactory{
+			Delegate: &duck.EnqueueInformerFactory{
+				Delegate:     addressable.Get(ctx),
+				EventHandler: controller.HandleAll(c.Tracker.OnChanged),
+			},
+		},
+	}
+	c.resolveSink = sr.resolve
+
 	return impl
 }
 
+// newRecorder returns the event recorder on the context, or one recording
+// to the API server.
+func newRecorder(ctx context.Context) record.EventRecorder {
+	if recorder := controller.GetEventRecorder(ctx); recorder != nil {
+		return recorder
+	}
+
+	logger := logging.FromContext(ctx)
+	eventBroadcaster := record.NewBroadcaster()
+	watches := []watch.Interface{
+		eventBroadcaster.StartLogging(logger.Named("event-broadcaster").Infof),
+		eventBroadcaster.StartRecordingToSink(
+			&typedcorev1.EventSinkImpl{Interface: kubeclient.Get(ctx).CoreV1().Events("")}),
+	}
+	go func() {
+		<-ctx.Done()
+		for _, w := range watches {
+			w.Stop()
+		}
+	}()
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+}
+
+// injectedBy returns the binding which injected the object, when it is a Pod.
+func injectedBy(obj interface{}) (types.NamespacedName, bool) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return types.NamespacedName{}, false
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(pod.Annotations[daytona.InjectedAnnotation])
+	if err != nil || namespace == "" || name == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, true
+}
+
+// boundBy returns the binding which injected, or in DryRun annotated, the
+// object, when it is a Pod.
+func boundBy(obj interface{}) (types.NamespacedName, bool) {
+	if key, ok := injectedBy(obj); ok {
+		return key, true
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return types.NamespacedName{}, false
+	}
+	var dr daytona.DryRun
+	if err := json.Unmarshal([]byte(pod.Annotations[daytona.DryRunAnnotation]), &dr); err != nil {
+		return types.NamespacedName{}, false
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(dr.Binding)
+	if err != nil || namespace == "" || name == "" {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, true
+}
+
 func ListAll(ctx context.Context, handler cache.ResourceEventHandler) podbinding.ListAll {
 	dbInformer := dbinformer.Get(ctx)
 
@@ -94,6 +258,10 @@ func ListAll(ctx context.Context, handler cache.ResourceEventHandler) podbinding
 		}
 		bl := make([]podbinding.Bindable, 0, len(l))
 		for _, elt := range l {
+			// Suspended bindings don't inject the Pods created meanwhile.
+			if elt.Spec.Suspend {
+				continue
+			}
 			bl = append(bl, elt)
 		}
 		return bl, nil
@@ -0,0 +1,456 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	admissionlisters "k8s.io/client-go/listers/admissionregistration/v1beta1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+	"github.com/dgerd/daytona-binding/pkg/metrics"
+	"github.com/dgerd/daytona-binding/pkg/registry"
+	"github.com/dgerd/daytona-binding/pkg/vault"
+)
+
+// Reconciler implements controller.Reconciler for DaytonaBinding resources.
+// It extends the podbinding.BaseReconciler flow with the DaytonaBinding
+// specific steps that must happen before the subjects are bound.
+type Reconciler struct {
+	*podbinding.BaseReconciler
+
+	// Resolver is used to resolve the tag of spec.image to a digest.
+	Resolver registry.Resolver
+
+	// DeploymentLister, ReplicaSetLister, StatefulSetLister and
+	// DaemonSetLister are used to find the workloads owning our subjects.
+	DeploymentLister  appsv1listers.DeploymentLister
+	ReplicaSetLister  appsv1listers.ReplicaSetLister
+	StatefulSetLister appsv1listers.StatefulSetLister
+	DaemonSetLister   appsv1listers.DaemonSetLister
+
+	// PodLister is used to find the Pods we injected, and how they fare.
+	PodLister corev1listers.PodLister
+
+	// MWHLister is used to check that the webhook intercepts our subjects.
+	MWHLister admissionlisters.MutatingWebhookConfigurationLister
+
+	// labelsNamespaces returns whether namespaces are labeled with their
+	// name, which the webhook entries selecting namespaces rely on.
+	labelsNamespaces func() (bool, error)
+
+	// NewVault returns a client for the Vault server at the provided
+	// address, which is used to follow the versions of injected secrets.
+	NewVault func(address string) vault.Client
+
+	// serviceAccountToken returns a token for the named service account.
+	serviceAccountToken func(namespace, name string) (string, error)
+
+	// controllerToken returns the token of the controller's own service
+	// account, which it logs in to Vault with for preflight checks.
+	controllerToken func() (string, error)
+
+	// resolveSink resolves the audit sinks of bindings.
+	resolveSink func(duckv1.Destination, interface{}) (*apis.URL, error)
+
+	configStore  *config.Store
+	enqueueAfter func(interface{}, time.Duration)
+
+	// resolved holds the number of subjects each binding last resolved to.
+	resolved sync.Map
+
+	// warned holds the generation of each binding whose risks we last
+	// reported.
+	warned sync.Map
+
+	// versionChecks holds the error each binding last failed to check its
+	// secret versions with.
+	versionChecks sync.Map
+
+	// tokens holds the Vault token we last logged in with as the subjects
+	// of each binding.
+	tokens sync.Map
+
+	// announced holds, per binding, the failed daytona runs we emitted an
+	// Event for.
+	announced sync.Map
+}
+
+// Check that our Reconciler implements controller.Reconciler
+var _ controller.Reconciler = (*Reconciler)(nil)
+
+// Reconcile implements controller.Reconciler. The flow of
+// podbinding.BaseReconciler.Reconcile is fixed to binding the subjects, so we
+// only mirror its shell, and build ours from the BaseReconciler helpers:
+// Get to fetch the binding, and UpdateStatus to write back its status.
+func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
+	ctx = r.configStore.ToContext(ctx)
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("invalid resource key: %s", key)
+		return nil
+	}
+	fb, err := r.Get(namespace, name)
+	if apierrs.IsNotFound(err) {
+		logging.FromContext(ctx).Errorf("resource %q no longer exists", key)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Don't modify the informers copy.
+	original := fb.(*v1alpha1.DaytonaBinding)
+	db := original.DeepCopy()
+
+	reconcileErr := r.reconcile(ctx, db)
+	r.reportReconcile(ctx, db)
+	if err := r.updateStatus(ctx, original, db); err != nil {
+		return err
+	}
+	// The Events on Pods are informational, so failing to emit them must
+	// not hold up the rest of the binding.
+	if err := r.announceInjections(original, db); err != nil {
+		logging.FromContext(ctx).Warnw("Failed to announce injections", zap.Error(err))
+	}
+	if reconcileErr != nil {
+		r.Recorder.Event(db, corev1.EventTypeWarning, "InternalError", reconcileErr.Error())
+	}
+	return reconcileErr
+}
+
+// reportReconcile records the outcome of the reconciliation of db.
+func (r *Reconciler) reportReconcile(ctx context.Context, db *v1alpha1.DaytonaBinding) {
+	var stale int32
+	if db.Status.StaleSubjects != nil {
+		stale = db.Status.StaleSubjects.Count
+	}
+	if err := metrics.ReportReconcile(ctx, db.Namespace, db.Name, db.Status.Conditions, stale); err != nil {
+		logging.FromContext(ctx).Warnw("Failed to report reconcile", zap.Error(err))
+	}
+}
+
+// updateStatus writes back the status of db when it differs from the status
+// we loaded from the informer's cache, which may be stale: writing an
+// unchanged status could overwrite a prior update.
+func (r *Reconciler) updateStatus(ctx context.Context, original, db *v1alpha1.DaytonaBinding) error {
+	if equality.Semantic.DeepEqual(original.Status, db.Status) {
+		return nil
+	}
+	if err := r.UpdateStatus(ctx, db); err != nil {
+		logging.FromContext(ctx).Warnw("Failed to update resource status", zap.Error(err))
+		r.Recorder.Eventf(db, corev1.EventTypeWarning, "UpdateFailed",
+			"Failed to update status for %q: %v", db.Name, err)
+		return err
+	}
+	return nil
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, db *v1alpha1.DaytonaBinding) error {
+	if db.GetDeletionTimestamp() != nil {
+		// Check for a DeletionTimestamp.  If present, elide the normal
+		// reconcile logic and do our finalizer handling.
+		if !r.IsFinalizing(ctx, db) {
+			return nil
+		}
+		if err := r.ReconcileDeletion(ctx, db); err != nil {
+			return err
+		}
+		r.forgetResolution(db)
+		r.forgetToken(ctx, db)
+		r.Recorder.Event(db, corev1.EventTypeNormal, "Unbound",
+			"Removed the binding from its subjects, the Pods created from now on aren't injected")
+		return nil
+	}
+	// Make sure that our conditions have been initialized.
+	db.Status.InitializeConditions()
+
+	// Make sure that the resource has a Finalizer configured, which
+	// enables us to undo our binding upon deletion.
+	if err := r.EnsureFinalizer(ctx, db); err != nil {
+		return err
+	}
+
+	// A suspended binding is left out of the webhook's index by ListAll,
+	// and must leave its subjects alone.
+	if db.Spec.Suspend {
+		db.Status.MarkSuspended()
+		r.forgetResolution(db)
+		r.forgetToken(ctx, db)
+		db.Status.SetObservedGeneration(db.Generation)
+		return nil
+	}
+	db.Status.ClearSuspended()
+
+	r.reconcileSpec(ctx, db)
+
+	// Pin the image before binding, so that Do injects the digest.
+	if err := r.reconcileImage(ctx, db); err != nil {
+		db.Status.MarkProfileUnresolved("ImageResolutionFailed", "%v", err)
+		return err
+	}
+	db.Status.MarkProfileResolved()
+
+	r.reconcilePolicy(ctx, db)
+
+	if err := r.reconcileWebhook(ctx, db); err != nil {
+		return err
+	}
+
+	r.reconcileAuditSink(ctx, db)
+
+	// Pods can't be patched to pick up a new configuration, so rather than
+	// performing our Binding's Do() method on the subject(s) of the Binding,
+	// we inspect them for injections that are out of date.
+	d := &drift{hash: db.ConfigHash(), rotatedAt: db.Status.SecretsRotatedAt}
+	if rs := db.Spec.Renewal; rs != nil {
+		// The renewer picks up rotated secrets in place.
+		d.rotatedAt = nil
+		if rs.Reload != nil {
+			d.reload = rs.Reload.Container
+		}
+	}
+	if err := r.ReconcileSubject(ctx, db, d.inspect); err != nil {
+		if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSubjectResolved); !c.IsFalse() {
+			db.Status.MarkBindingUnavailable("SubjectResolutionFailed", err.Error())
+		}
+		r.Recorder.Eventf(db, corev1.EventTypeWarning, "SubjectResolutionFailed",
+			"Failed to resolve %s %s: %v", db.Spec.Subject.Kind, describeSubject(db), err)
+		return err
+	}
+	r.recordResolution(db, len(d.subjects))
+	r.reconcileMatchedSubjects(ctx, db, d.subjects)
+
+	// The admission of subjects lacking the container to reload is denied.
+	if len(d.unreloadable) > 0 {
+		sort.Strings(d.unreloadable)
+		msg := fmt.Sprintf("%s %s has no container named %q to reload",
+			db.Spec.Subject.Kind, strings.Join(d.unreloadable, ", "), d.reload)
+		db.Status.MarkBindingUnavailable("ReloadContainerNotFound", msg)
+		r.Recorder.Event(db, corev1.EventTypeWarning, "ReloadContainerNotFound", msg)
+	}
+
+	// Catch mistakes in the Vault configuration before subjects crash on it.
+	r.reconcilePreflight(ctx, db, d.serviceAccount)
+
+	if db.IsDryRun() {
+		// Nothing was injected, so there is nothing to keep up to date.
+		db.Status.MarkStaleSubjects(nil)
+		db.Status.MarkUnhealthySubjects(nil)
+		db.Status.InjectedPods = 0
+		if err := r.reconcileDryRun(ctx, db); err != nil {
+			return err
+		}
+		db.Status.SetObservedGeneration(db.Generation)
+		return nil
+	}
+	db.Status.MatchedPods = 0
+
+	db.Status.MarkStaleSubjects(d.stale)
+
+	if err := r.reconcileHealth(ctx, db); err != nil {
+		return err
+	}
+
+	if err := r.reconcileRollout(ctx, db, d.owners); err != nil {
+		return err
+	}
+
+	// The Events on Pods are informational, so failing to list them must
+	// not hold up the rest of the binding, the next reconcile will try
+	// again.
+	if err := r.trackInjections(db); err != nil {
+		logging.FromContext(ctx).Warnw("Failed to track injections", zap.Error(err))
+	}
+
+	// A Vault outage must not hold up the rest of the binding, the next
+	// poll will try again.
+	err := r.reconcileSecretVersions(ctx, db, d.serviceAccount)
+	if err != nil {
+		logging.FromContext(ctx).Warnw("Failed to check secret versions", zap.Error(err))
+	}
+	r.recordVersionCheck(db, err)
+
+	// Update the observed generation once we have successfully reconciled
+	// our spec.
+	db.Status.SetObservedGeneration(db.Generation)
+	return nil
+}
+
+// reconcileSpec marks whether the spec is valid.  The webhook rejects
+// invalid specs, but not those stored before its validation was tightened.
+// The image policy may change at any time, so it is left to reconcilePolicy.
+// The risks a valid spec puts its subjects at are reported once per
+// generation, for the clients that don't print the warnings the validating
+// webhook returns.
+func (r *Reconciler) reconcileSpec(ctx context.Context, db *v1alpha1.DaytonaBinding) {
+	if err := db.Validate(config.ToContext(ctx, &config.Config{})); err != nil {
+		db.Status.MarkSpecInvalid(err)
+		return
+	}
+	db.Status.MarkSpecValid()
+
+	// The reconciles failing before the generation is observed are retried,
+	// which mustn't report its risks again.
+	key := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	if g, ok := r.warned.Load(key); db.Generation == db.Status.ObservedGeneration || ok && g.(int64) == db.Generation {
+		return
+	}
+	r.warned.Store(key, db.Generation)
+	for _, w := range db.Warnings(ctx) {
+		r.Recorder.Event(db, corev1.EventTypeWarning, "RiskyConfiguration", w)
+	}
+}
+
+// reconcilePolicy marks whether the image we inject is permitted by the
+// current policy, as the admission of the subjects is denied otherwise.
+func (r *Reconciler) reconcilePolicy(ctx context.Context, db *v1alpha1.DaytonaBinding) {
+	if err := config.FromContextOrDefaults(ctx).Daytona.CheckImage(db.GetImage()); err != nil {
+		db.Status.MarkPolicyDenied(err)
+		return
+	}
+	db.Status.MarkPolicyAllowed()
+}
+
+// reconcileImage records the digest that spec.image currently resolves to
+// when tag resolution is enabled.  An image is only resolved once, so that
+// Pods created long after each other receive the same bytes.
+func (r *Reconciler) reconcileImage(ctx context.Context, db *v1alpha1.DaytonaBinding) error {
+	if !config.FromContextOrDefaults(ctx).Daytona.ResolveImageTags {
+		db.Status.ResolvedImage = ""
+		return nil
+	}
+
+	ref, err := registry.ParseReference(db.Spec.Image)
+	if err != nil {
+		return err
+	}
+	if ref.HasDigest() {
+		// Already pinned, nothing to resolve.
+		db.Status.ResolvedImage = ""
+		return nil
+	}
+	if db.GetImage() != db.Spec.Image {
+		// We have already resolved this spec.image.
+		return nil
+	}
+
+	resolved, err := r.Resolver.Resolve(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %q: %w", db.Spec.Image, err)
+	}
+	logging.FromContext(ctx).Infof("Resolved %s to %s", db.Spec.Image, resolved)
+	db.Status.ResolvedImage = resolved.String()
+	return nil
+}
+
+// reconcileMatchedSubjects records the subjects the binding resolves to, and
+// warns once it has resolved to none for long enough.
+func (r *Reconciler) reconcileMatchedSubjects(ctx context.Context, db *v1alpha1.DaytonaBinding, subjects []string) {
+	db.Status.MarkMatchedSubjects(subjects)
+	if len(subjects) > 0 {
+		return
+	}
+	period := config.FromContextOrDefaults(ctx).Daytona.NoSubjectsPeriod
+	if left := db.Status.MarkNoSubjects(period); left > 0 && r.enqueueAfter != nil {
+		r.enqueueAfter(db, left)
+	}
+}
+
+// drift collects the subjects whose injected configuration is out of date.
+type drift struct {
+	// hash is the binding's current ConfigHash.
+	hash string
+
+	mu       sync.Mutex
+	subjects []string
+	stale    []string
+	owners   []owner
+
+	// rotatedAt is when the controller last saw the binding's secrets
+	// rotate, the subjects created before it read the prior versions.
+	rotatedAt *metav1.Time
+
+	// serviceAccount is the first, by name, of the service accounts of the
+	// subjects.
+	serviceAccount string
+
+	// reload is the name of the container the renewer reloads, if any, and
+	// unreloadable the subjects that lack it.
+	reload       string
+	unreloadable []string
+}
+
+// inspect is a podbinding.Mutation that records, rather than updates, the
+// subjects that were not injected with the current configuration.
+func (d *drift) inspect(ctx context.Context, ps *duckv1.WithPodable) {
+	if ps.DeletionTimestamp != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subjects = append(d.subjects, ps.Name)
+	sa := ps.Spec.ServiceAccountName
+	if sa == "" {
+		sa = "default"
+	}
+	if d.serviceAccount == "" || sa < d.serviceAccount {
+		d.serviceAccount = sa
+	}
+	if d.reload != "" && !hasContainer(ps, d.reload) {
+		d.unreloadable = append(d.unreloadable, ps.Name)
+	}
+	if ps.Annotations[daytona.ConfigHashAnnotation] == d.hash &&
+		(d.rotatedAt == nil || !ps.CreationTimestamp.Before(d.rotatedAt)) {
+		return
+	}
+	d.stale = append(d.stale, ps.Name)
+	if ref := metav1.GetControllerOf(ps); ref != nil {
+		d.owners = append(d.owners, owner{namespace: ps.Namespace, ref: *ref})
+	}
+}
+
+// hasContainer returns whether the subject has a container of the provided
+// name.
+func hasContainer(ps *duckv1.WithPodable, name string) bool {
+	for _, c := range ps.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+	"github.com/dgerd/daytona-binding/pkg/registry"
+)
+
+const testDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+type fakeResolver struct {
+	calls int
+}
+
+func (f *fakeResolver) Resolve(ctx context.Context, ref registry.Reference) (registry.Reference, error) {
+	f.calls++
+	ref.Digest = testDigest
+	return ref, nil
+}
+
+func TestReconcileImage(t *testing.T) {
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{ResolveImageTags: true},
+	})
+	resolver := &fakeResolver{}
+	r := &Reconciler{Resolver: resolver}
+
+	db := &v1alpha1.DaytonaBinding{
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Image: "gcr.io/dangerd-dev/daytona:1.2",
+		},
+	}
+	if err := r.reconcileImage(ctx, db); err != nil {
+		t.Fatalf("reconcileImage() = %v", err)
+	}
+	if got, want := db.GetImage(), "gcr.io/dangerd-dev/daytona:1.2@"+testDigest; got != want {
+		t.Errorf("GetImage() = %s, want %s", got, want)
+	}
+
+	// A second reconcile must not re-resolve the same image.
+	if err := r.reconcileImage(ctx, db); err != nil {
+		t.Fatalf("reconcileImage() = %v", err)
+	}
+	if resolver.calls != 1 {
+		t.Errorf("Resolve() called %d times, want 1", resolver.calls)
+	}
+
+	// Changing the image invalidates the previous resolution.
+	db.Spec.Image = "gcr.io/dangerd-dev/daytona:1.3"
+	if got := db.GetImage(); got != db.Spec.Image {
+		t.Errorf("GetImage() = %s, want %s", got, db.Spec.Image)
+	}
+	if err := r.reconcileImage(ctx, db); err != nil {
+		t.Fatalf("reconcileImage() = %v", err)
+	}
+	if resolver.calls != 2 {
+		t.Errorf("Resolve() called %d times, want 2", resolver.calls)
+	}
+
+	// Disabling resolution clears the status.
+	if err := r.reconcileImage(context.Background(), db); err != nil {
+		t.Fatalf("reconcileImage() = %v", err)
+	}
+	if db.Status.ResolvedImage != "" {
+		t.Errorf("ResolvedImage = %s, want empty", db.Status.ResolvedImage)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	db := &v1alpha1.DaytonaBinding{
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Image: "gcr.io/dangerd-dev/daytona:1.2",
+		},
+	}
+	rotatedAt := metav1.NewTime(time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC))
+	d := &drift{hash: db.ConfigHash(), rotatedAt: &rotatedAt}
+
+	for name, p := range map[string]struct {
+		hash, serviceAccount string
+		created              time.Time
+	}{
+		"current": {db.ConfigHash(), "web", rotatedAt.Add(time.Minute)},
+		"rotated": {db.ConfigHash(), "web", rotatedAt.Add(-time.Minute)},
+		"old":     {"0123", "api", rotatedAt.Add(time.Minute)},
+		"never":   {"", "", rotatedAt.Add(time.Minute)},
+	} {
+		pod := &duckv1.WithPodable{}
+		pod.Name = name
+		pod.CreationTimestamp = metav1.NewTime(p.created)
+		pod.Spec.ServiceAccountName = p.serviceAccount
+		if p.hash != "" {
+			pod.Annotations = map[string]string{daytona.ConfigHashAnnotation: p.hash}
+		}
+		d.inspect(context.Background(), pod)
+	}
+
+	if got, want := len(d.subjects), 4; got != want {
+		t.Errorf("len(subjects) = %d, want %d", got, want)
+	}
+	// Whatever the order the subjects were listed in.
+	if got, want := d.serviceAccount, "api"; got != want {
+		t.Errorf("serviceAccount = %q, want %q", got, want)
+	}
+	db.Status.MarkStaleSubjects(d.stale)
+	if got, want := db.Status.StaleSubjects.Count, int32(3); got != want {
+		t.Errorf("StaleSubjects.Count = %d, want %d", got, want)
+	}
+	if diff := cmp.Diff([]string{"never", "old", "rotated"}, db.Status.StaleSubjects.Names); diff != "" {
+		t.Errorf("StaleSubjects.Names (-want, +got) = %s", diff)
+	}
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSubjectsUpToDate); c == nil || !c.IsFalse() {
+		t.Errorf("SubjectsUpToDate = %v, want False", c)
+	}
+
+	db.Status.MarkStaleSubjects(nil)
+	if db.Status.StaleSubjects != nil {
+		t.Errorf("StaleSubjects = %v, want nil", db.Status.StaleSubjects)
+	}
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSubjectsUpToDate); c == nil || !c.IsTrue() {
+		t.Errorf("SubjectsUpToDate = %v, want True", c)
+	}
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionReady); c != nil {
+		t.Errorf("Ready = %v, want unset", c)
+	}
+}
+
+func TestDriftReload(t *testing.T) {
+	d := &drift{reload: "app"}
+	for name, containers := range map[string][]string{
+		"reloadable": {"app", "proxy"},
+		"renamed":    {"web"},
+		"empty":      nil,
+	} {
+		pod := &duckv1.WithPodable{}
+		pod.Name = name
+		for _, c := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: c})
+		}
+		d.inspect(context.Background(), pod)
+	}
+
+	sort.Strings(d.unreloadable)
+	if diff := cmp.Diff([]string{"empty", "renamed"}, d.unreloadable); diff != "" {
+		t.Errorf("unreloadable (-want, +got) = %s", diff)
+	}
+}
+
+func TestReconcileSpecAndPolicy(t *testing.T) {
+	r := &Reconciler{}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Namespace:  "default",
+				Name:       "pod",
+			},
+			Image: "docker.io/cruise/daytona:1.2",
+			Auth:  "true",
+		},
+	}
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{AllowedImages: []string{"gcr.io/dangerd-dev"}},
+	})
+
+	// The image policy is only for reconcilePolicy to enforce.
+	r.reconcileSpec(ctx, db)
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSpecValid); c == nil || !c.IsTrue() {
+		t.Errorf("SpecValid = %v, want True", c)
+	}
+	r.reconcilePolicy(ctx, db)
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionPolicyAllowed); c == nil || !c.IsFalse() || c.Reason != "ImageNotAllowed" {
+		t.Errorf("PolicyAllowed = %v, want False with ImageNotAllowed", c)
+	}
+
+	db.Spec.Image = "gcr.io/dangerd-dev/daytona:1.2"
+	r.reconcilePolicy(ctx, db)
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionPolicyAllowed); c == nil || !c.IsTrue() {
+		t.Errorf("PolicyAllowed = %v, want True", c)
+	}
+
+	// A new generation has its risks reported.
+	recorder := record.NewFakeRecorder(10)
+	r.BaseReconciler = &podbinding.BaseReconciler{Recorder: recorder}
+	db.Generation = 2
+	db.Spec.VaultSecretsGlobal = "secret/global"
+	r.reconcileSpec(ctx, db)
+	if got := events(recorder); len(got) != 2 {
+		t.Errorf("Events = %q, want the tag and global secrets warnings", got)
+	}
+	// The reconcile failed, and is retried before the generation is
+	// observed.
+	r.reconcileSpec(ctx, db)
+	if got := events(recorder); len(got) != 0 {
+		t.Errorf("Events = %q, want none for a retried generation", got)
+	}
+	db.Status.ObservedGeneration = 2
+	r.reconcileSpec(ctx, db)
+	if got := events(recorder); len(got) != 0 {
+		t.Errorf("Events = %q, want none for an observed generation", got)
+	}
+
+	db.Spec.Image = ""
+	r.reconcileSpec(ctx, db)
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSpecValid); c == nil || !c.IsFalse() || c.Reason != "InvalidSpec" {
+		t.Errorf("SpecValid = %v, want False with InvalidSpec", c)
+	}
+}
+
+func TestReconcileSpecStatusAdmitted(t *testing.T) {
+	// The binding was stored before the validation and the policy were
+	// tightened.
+	original := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Namespace:  "default",
+				Name:       "pod",
+			},
+			Image:         "docker.io/cruise/daytona:1.2",
+			ReadinessGate: true,
+		},
+	}
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{AllowedImages: []string{"gcr.io/dangerd-dev"}},
+	})
+
+	r := &Reconciler{}
+	db := original.DeepCopy()
+	db.Status.InitializeConditions()
+	r.reconcileSpec(ctx, db)
+	r.reconcilePolicy(ctx, db)
+	for _, ct := range []apis.ConditionType{v1alpha1.DaytonaBindingConditionSpecValid, v1alpha1.DaytonaBindingConditionPolicyAllowed} {
+		if c := db.Status.GetCondition(ct); c == nil || !c.IsFalse() {
+			t.Errorf("%s = %v, want False", ct, c)
+		}
+	}
+
+	// The webhook validates the status update that persists them.
+	if err := db.Validate(apis.WithinSubResourceUpdate(ctx, original, "status")); err != nil {
+		t.Errorf("Validate() of the status update = %v", err)
+	}
+}
+
+func TestReconcileMatchedSubjects(t *testing.T) {
+	var enqueued time.Duration
+	r := &Reconciler{
+		enqueueAfter: func(_ interface{}, d time.Duration) { enqueued = d },
+	}
+	db := &v1alpha1.DaytonaBinding{}
+	noSubjects := func() *apis.Condition {
+		return db.Status.GetCondition(v1alpha1.DaytonaBindingConditionNoSubjects)
+	}
+
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{NoSubjectsPeriod: time.Hour},
+	})
+	r.reconcileMatchedSubjects(ctx, db, nil)
+	if got := db.Status.MatchedSubjects; got == nil || got.Count != 0 {
+		t.Errorf("MatchedSubjects = %v, want a count of 0", got)
+	}
+	if c := noSubjects(); c == nil || !c.IsUnknown() || c.Severity != apis.ConditionSeverityWarning {
+		t.Errorf("NoSubjects = %v, want an Unknown warning", c)
+	}
+	if enqueued <= 0 || enqueued > time.Hour {
+		t.Errorf("Enqueued after %v, want at most an hour", enqueued)
+	}
+
+	// Once the period is over, the warning is raised.
+	ctx = config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{NoSubjectsPeriod: 0},
+	})
+	r.reconcileMatchedSubjects(ctx, db, nil)
+	if c := noSubjects(); c == nil || !c.IsTrue() || c.Reason != "NoSubjects" {
+		t.Errorf("NoSubjects = %v, want True", c)
+	}
+
+	r.reconcileMatchedSubjects(ctx, db, []string{"b", "a"})
+	if diff := cmp.Diff(&v1alpha1.SubjectList{Count: 2, Names: []string{"a", "b"}}, db.Status.MatchedSubjects); diff != "" {
+		t.Errorf("MatchedSubjects (-want, +got) = %s", diff)
+	}
+	if c := noSubjects(); c != nil {
+		t.Errorf("NoSubjects = %v, want none", c)
+	}
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionReady); c != nil {
+		t.Errorf("Ready = %v, want unset", c)
+	}
+}
+
+func TestReconcileSuspended(t *testing.T) {
+	// Any attempt at resolving the image or the subjects would panic.
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{
+			GVR: v1alpha1.SchemeGroupVersion.WithResource("daytonabindings"),
+		},
+	}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "binding",
+			Generation: 2,
+			Finalizers: []string{"daytonabindings.binding.app"},
+		},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Image:   "gcr.io/dangerd-dev/daytona:1.2",
+			Suspend: true,
+		},
+	}
+
+	if err := r.reconcile(context.Background(), db); err != nil {
+		t.Fatalf("reconcile() = %v", err)
+	}
+	if cond := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSuspended); cond == nil || !cond.IsTrue() {
+		t.Errorf("Suspended = %v, wanted True", cond)
+	}
+	if got := db.Status.ObservedGeneration; got != 2 {
+		t.Errorf("ObservedGeneration = %d, wanted 2", got)
+	}
+
+	db.Status.ClearSuspended()
+	if cond := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSuspended); cond != nil {
+		t.Errorf("Suspended = %v after ClearSuspended(), wanted none", cond)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// reconcileDryRun counts the Pods the binding, in DryRun, annotated with the
+// injection that would have happened.
+func (r *Reconciler) reconcileDryRun(ctx context.Context, db *v1alpha1.DaytonaBinding) error {
+	pods, err := r.PodLister.Pods(db.Spec.Subject.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	key := db.Namespace + "/" + db.Name
+	var matched int32
+	for _, pod := range pods {
+		a, ok := pod.Annotations[daytona.DryRunAnnotation]
+		if !ok || pod.DeletionTimestamp != nil {
+			continue
+		}
+		var dr daytona.DryRun
+		if err := json.Unmarshal([]byte(a), &dr); err != nil || dr.Binding != key {
+			continue
+		}
+		matched++
+	}
+	db.Status.MatchedPods = matched
+	return nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/tracker"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+func TestReconcileDryRun(t *testing.T) {
+	pod := func(name, annotation string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        name,
+				Annotations: map[string]string{daytona.DryRunAnnotation: annotation},
+			},
+		}
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, p := range []*corev1.Pod{
+		pod("matched", `{"binding":"default/binding"}`),
+		pod("denied", `{"binding":"default/binding","denied":"conflict"}`),
+		pod("other", `{"binding":"default/other"}`),
+		pod("garbled", `{`),
+	} {
+		indexer.Add(p)
+	}
+	r := &Reconciler{PodLister: corev1listers.NewPodLister(indexer)}
+
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Namespace:  "default",
+			},
+			Enforcement: v1alpha1.EnforcementDryRun,
+		},
+	}
+	if err := r.reconcileDryRun(context.Background(), db); err != nil {
+		t.Fatalf("reconcileDryRun() = %v", err)
+	}
+	if got, want := db.Status.MatchedPods, int32(2); got != want {
+		t.Errorf("MatchedPods = %d, wanted %d", got, want)
+	}
+}
+
+func TestBoundBy(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		annotations map[string]string
+		want        types.NamespacedName
+		wantOK      bool
+	}{{
+		name:        "injected",
+		annotations: map[string]string{daytona.InjectedAnnotation: "default/binding"},
+		want:        types.NamespacedName{Namespace: "default", Name: "binding"},
+		wantOK:      true,
+	}, {
+		name:        "dry run",
+		annotations: map[string]string{daytona.DryRunAnnotation: `{"binding":"default/binding"}`},
+		want:        types.NamespacedName{Namespace: "default", Name: "binding"},
+		wantOK:      true,
+	}, {
+		name:        "garbled dry run",
+		annotations: map[string]string{daytona.DryRunAnnotation: "default/binding"},
+	}, {
+		name: "untouched",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := boundBy(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}})
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("boundBy() = %v, %v, wanted %v, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// recordResolution emits an Event whenever the number of subjects the
+// binding resolves to changes.  The counts are only remembered for the
+// lifetime of the controller, so that it emits one Event per binding when
+// it starts.
+func (r *Reconciler) recordResolution(db *v1alpha1.DaytonaBinding, subjects int) {
+	key := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	if previous, ok := r.resolved.Load(key); ok && previous.(int) == subjects {
+		return
+	}
+	r.resolved.Store(key, subjects)
+
+	if subjects == 0 {
+		r.Recorder.Eventf(db, corev1.EventTypeWarning, "NoSubjects",
+			"%s %s matches no subjects", db.Spec.Subject.Kind, describeSubject(db))
+		return
+	}
+	r.Recorder.Eventf(db, corev1.EventTypeNormal, "SubjectsResolved",
+		"%s %s resolved to %d subject(s)", db.Spec.Subject.Kind, describeSubject(db), subjects)
+}
+
+// forgetResolution drops what recordResolution, reconcileSpec,
+// recordVersionCheck and reconcileHealth remember of the binding.
+func (r *Reconciler) forgetResolution(db *v1alpha1.DaytonaBinding) {
+	nn := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	r.resolved.Delete(nn)
+	r.warned.Delete(nn)
+	r.versionChecks.Delete(nn)
+	r.announced.Delete(nn)
+}
+
+// describeSubject returns how the binding refers to its subjects.
+func describeSubject(db *v1alpha1.DaytonaBinding) string {
+	subject := db.Spec.Subject
+	if subject.Selector != nil {
+		return "selector in " + subject.Namespace
+	}
+	return subject.Namespace + "/" + subject.Name
+}
+
+// trackInjections records in the status of the binding the UIDs of the live
+// Pods it injected, for announceInjections.
+func (r *Reconciler) trackInjections(db *v1alpha1.DaytonaBinding) error {
+	pods, err := r.PodLister.Pods(db.Spec.Subject.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	key := db.Namespace + "/" + db.Name
+	var uids []types.UID
+	for _, pod := range pods {
+		if pod.Annotations[daytona.InjectedAnnotation] != key || pod.DeletionTimestamp != nil {
+			continue
+		}
+		uids = append(uids, pod.UID)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	db.Status.AnnouncedPods = uids
+	return nil
+}
+
+// announceInjections emits an Event on each live Pod the binding injected
+// naming the binding, so that `kubectl describe pod` tells where its daytona
+// container comes from.  Pods can't be referenced before they are created,
+// which is why this is left to the controller rather than done at admission.
+// It is called once the status of the binding is written, and only announces
+// the Pods that status lists and the original one didn't, so that the Pods
+// created while the controller was down are announced once it is back, and
+// never twice: of several replicas of the controller, only the one whose
+// status update lands announces them.
+func (r *Reconciler) announceInjections(original, db *v1alpha1.DaytonaBinding) error {
+	announced := make(map[types.UID]bool, len(original.Status.AnnouncedPods))
+	for _, uid := range original.Status.AnnouncedPods {
+		announced[uid] = true
+	}
+	fresh := make(map[types.UID]bool, len(db.Status.AnnouncedPods))
+	for _, uid := range db.Status.AnnouncedPods {
+		if !announced[uid] {
+			fresh[uid] = true
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	pods, err := r.PodLister.Pods(db.Spec.Subject.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if !fresh[pod.UID] {
+			continue
+		}
+		r.Recorder.Eventf(pod, corev1.EventTypeNormal, "Injected",
+			"Injected daytona to fetch secrets from Vault, as configured by DaytonaBinding %s/%s", db.Namespace, db.Name)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// events drains the events recorded so far.
+func events(recorder *record.FakeRecorder) []string {
+	var got []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			got = append(got, e)
+		default:
+			return got
+		}
+	}
+}
+
+func TestRecordResolution(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{Recorder: recorder},
+	}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Namespace:  "default",
+				Name:       "app",
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		subjects int
+		want     []string
+	}{
+		{2, []string{"Normal SubjectsResolved Deployment default/app resolved to 2 subject(s)"}},
+		{2, nil},
+		{0, []string{"Warning NoSubjects Deployment default/app matches no subjects"}},
+		{1, []string{"Normal SubjectsResolved Deployment default/app resolved to 1 subject(s)"}},
+	} {
+		r.recordResolution(db, test.subjects)
+		if diff := cmp.Diff(test.want, events(recorder)); diff != "" {
+			t.Errorf("recordResolution(%d) (-want, +got) = %s", test.subjects, diff)
+		}
+	}
+
+	// Once forgotten, the binding gets an Event again.
+	r.forgetResolution(db)
+	r.recordResolution(db, 1)
+	if got := events(recorder); len(got) != 1 {
+		t.Errorf("recordResolution() after forgetResolution() = %v, wanted an Event", got)
+	}
+}
+
+func TestAnnounceInjections(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{Recorder: recorder},
+		PodLister:      corev1listers.NewPodLister(indexer),
+	}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{APIVersion: "v1", Kind: "Pod", Namespace: "default"},
+		},
+		Status: v1alpha1.DaytonaBindingStatus{
+			AnnouncedPods: []types.UID{"announced", "gone"},
+		},
+	}
+	pod := func(name, binding string) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        name,
+				UID:         types.UID(name),
+				Annotations: map[string]string{},
+			},
+		}
+		if binding != "" {
+			p.Annotations[daytona.InjectedAnnotation] = binding
+		}
+		return p
+	}
+	deleting := pod("deleting", "default/binding")
+	deleting.DeletionTimestamp = &metav1.Time{}
+	for _, p := range []*corev1.Pod{
+		pod("injected", "default/binding"),
+		pod("announced", "default/binding"),
+		deleting,
+		pod("other", "default/other"),
+		pod("untouched", ""),
+	} {
+		indexer.Add(p)
+	}
+
+	original := db.DeepCopy()
+	if err := r.trackInjections(db); err != nil {
+		t.Fatalf("trackInjections() = %v", err)
+	}
+	if diff := cmp.Diff([]types.UID{"announced", "injected"}, db.Status.AnnouncedPods); diff != "" {
+		t.Errorf("AnnouncedPods (-want, +got) = %s", diff)
+	}
+	if got := events(recorder); len(got) != 0 {
+		t.Errorf("trackInjections() events = %v, wanted none before the status is written", got)
+	}
+
+	if err := r.announceInjections(original, db); err != nil {
+		t.Fatalf("announceInjections() = %v", err)
+	}
+	want := []string{"Normal Injected Injected daytona to fetch secrets from Vault, as configured by DaytonaBinding default/binding"}
+	if diff := cmp.Diff(want, events(recorder)); diff != "" {
+		t.Errorf("announceInjections() events (-want, +got) = %s", diff)
+	}
+
+	// Once the status lists them, the Pods aren't announced again.
+	original = db.DeepCopy()
+	if err := r.trackInjections(db); err != nil {
+		t.Fatalf("trackInjections() = %v", err)
+	}
+	if err := r.announceInjections(original, db); err != nil {
+		t.Fatalf("announceInjections() = %v", err)
+	}
+	if got := events(recorder); len(got) != 0 {
+		t.Errorf("announceInjections() events = %v, wanted none for announced Pods", got)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// reconcileHealth reflects the Pods we injected, and the failures of their
+// daytona container, in the binding's status, and emits an Event for every
+// failed run of daytona, which is identified by the Pod's UID and the restart
+// count of its daytona container.
+func (r *Reconciler) reconcileHealth(ctx context.Context, db *v1alpha1.DaytonaBinding) error {
+	pods, err := r.PodLister.Pods(db.Spec.Subject.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	key := db.Namespace + "/" + db.Name
+	failures := make(map[string]string)
+	runs := make(map[string]string)
+	var injected int32
+	last := db.Status.LastInjectionTime
+	for _, pod := range pods {
+		if pod.Annotations[daytona.InjectedAnnotation] != key || pod.DeletionTimestamp != nil {
+			continue
+		}
+		injected++
+		if last == nil || last.Before(&pod.CreationTimestamp) {
+			last = pod.CreationTimestamp.DeepCopy()
+		}
+		if f := daytona.Failure(pod); f != nil {
+			failures[pod.Name] = describeFailure(f)
+			runs[failedRun(pod)] = pod.Name
+		}
+	}
+
+	nn := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	announced, ok := r.announced.Load(nn)
+	if !ok {
+		// We don't remember this binding, e.g. after a restart of the
+		// controller, so take the failures listed in its status as
+		// announced rather than repeating their Events.
+		listed := sets.NewString()
+		if us := db.Status.UnhealthySubjects; us != nil {
+			listed.Insert(us.Names...)
+		}
+		seed := sets.NewString()
+		for run, name := range runs {
+			if listed.Has(name) {
+				seed.Insert(run)
+			}
+		}
+		announced = seed
+	}
+	for run, name := range runs {
+		if !announced.(sets.String).Has(run) {
+			r.Recorder.Eventf(db, corev1.EventTypeWarning, "SubjectFailed",
+				"daytona failed in Pod %s: %s", name, failures[name])
+		}
+	}
+	// Only remember the failures that are still current, which drops
+	// those of deleted Pods.
+	current := sets.NewString()
+	for run := range runs {
+		current.Insert(run)
+	}
+	r.announced.Store(nn, current)
+
+	db.Status.InjectedPods = injected
+	db.Status.LastInjectionTime = last
+	db.Status.MarkUnhealthySubjects(failures)
+	return nil
+}
+
+// failedRun identifies the current run of the daytona container of the Pod.
+func failedRun(pod *corev1.Pod) string {
+	var restarts int32
+	if cs := daytona.ContainerStatus(pod); cs != nil {
+		restarts = cs.RestartCount
+	}
+	return fmt.Sprintf("%s/%d", pod.UID, restarts)
+}
+
+// describeFailure returns a one line description of a failed daytona run.
+func describeFailure(t *corev1.ContainerStateTerminated) string {
+	desc := fmt.Sprintf("exit code %d", t.ExitCode)
+	if t.Reason != "" {
+		desc += " (" + t.Reason + ")"
+	}
+	if msg := strings.TrimSpace(t.Message); msg != "" {
+		// Only keep the last line, which usually holds the error.
+		lines := strings.Split(msg, "\n")
+		desc += ": " + strings.TrimSpace(lines[len(lines)-1])
+	}
+	return desc
+}
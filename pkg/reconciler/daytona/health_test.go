@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+func TestReconcileHealth(t *testing.T) {
+	created := metav1.NewTime(time.Now().Truncate(time.Second))
+	pod := func(name, binding string, state corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              name,
+				UID:               types.UID(name),
+				Annotations:       map[string]string{daytona.InjectedAnnotation: binding},
+				CreationTimestamp: created,
+			},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  daytona.ContainerName,
+					State: state,
+				}},
+			},
+		}
+	}
+	failed := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+		ExitCode: 1,
+		Reason:   "Error",
+		Message:  "reading secrets\npermission denied\n",
+	}}
+	succeeded := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, p := range []*corev1.Pod{
+		pod("broken", "default/binding", failed),
+		pod("fine", "default/binding", succeeded),
+		pod("other", "default/other-binding", failed),
+	} {
+		indexer.Add(p)
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{Recorder: recorder},
+		PodLister:      corev1listers.NewPodLister(indexer),
+	}
+
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Namespace:  "default",
+			},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.reconcileHealth(context.Background(), db); err != nil {
+			t.Fatalf("reconcileHealth() = %v", err)
+		}
+	}
+
+	want := &v1alpha1.SubjectList{Count: 1, Names: []string{"broken"}}
+	if diff := cmp.Diff(want, db.Status.UnhealthySubjects); diff != "" {
+		t.Errorf("UnhealthySubjects (-want, +got) = %s", diff)
+	}
+	if got, want := db.Status.InjectedPods, int32(2); got != want {
+		t.Errorf("InjectedPods = %d, want %d", got, want)
+	}
+	if got := db.Status.LastInjectionTime; got == nil || !got.Equal(&created) {
+		t.Errorf("LastInjectionTime = %v, want %v", got, created)
+	}
+	c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionSubjectsHealthy)
+	if c == nil || !c.IsFalse() || c.Message != "daytona is failing in 1 subject(s), e.g. broken: exit code 1 (Error): permission denied" {
+		t.Errorf("SubjectsHealthy = %v", c)
+	}
+
+	// Each failed run of daytona is worth a single Event.
+	if got, want := len(recorder.Events), 1; got != want {
+		t.Fatalf("Recorded %d events, want %d", got, want)
+	}
+	if got, want := <-recorder.Events, "Warning SubjectFailed daytona failed in Pod broken: exit code 1 (Error): permission denied"; got != want {
+		t.Errorf("Event = %q, want %q", got, want)
+	}
+
+	retried := pod("broken", "default/binding", failed)
+	retried.Status.InitContainerStatuses[0].RestartCount = 1
+	indexer.Update(retried)
+	if err := r.reconcileHealth(context.Background(), db); err != nil {
+		t.Fatalf("reconcileHealth() = %v", err)
+	}
+	if got, want := len(recorder.Events), 1; got != want {
+		t.Fatalf("Recorded %d events after a retry, want %d", got, want)
+	}
+	<-recorder.Events
+
+	// A restarted controller doesn't repeat the Events of the failures
+	// listed in the status.
+	r.forgetResolution(db)
+	if err := r.reconcileHealth(context.Background(), db); err != nil {
+		t.Fatalf("reconcileHealth() = %v", err)
+	}
+	if got := len(recorder.Events); got != 0 {
+		t.Errorf("Recorded %d events after a restart, want 0", got)
+	}
+}
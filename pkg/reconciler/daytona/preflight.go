@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/vault"
+)
+
+// reconcilePreflight verifies the Vault configuration of the binding, when
+// a preflight role is configured, so that a typo shows up in its status
+// rather than as crashing subjects. The role's access to the secrets is
+// asked of Vault, logged in as the subjects' service account, so that it is
+// evaluated the way Vault evaluates it when daytona reads them, along with
+// its access to their metadata, which the controller reads to follow their
+// versions. A verified configuration is only verified again once the
+// binding changes.
+func (r *Reconciler) reconcilePreflight(ctx context.Context, db *v1alpha1.DaytonaBinding, serviceAccount string) {
+	cfg := config.FromContextOrDefaults(ctx).Daytona
+	if auth, _ := strconv.ParseBool(db.Spec.Auth); !auth || cfg.VaultAddress == "" || cfg.PreflightRole == "" {
+		db.Status.ClearVaultConfigVerified()
+		return
+	}
+	if c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionVaultConfigVerified); c != nil && c.IsTrue() &&
+		db.Status.ObservedGeneration == db.Generation {
+		return
+	}
+
+	jwt, err := r.controllerToken()
+	if err != nil {
+		db.Status.MarkVaultConfigUnverified("PreflightFailed", "failed to read the controller's token: %v", err)
+		return
+	}
+	client := r.NewVault(cfg.VaultAddress)
+	login, err := client.Login(ctx, cfg.PreflightAuthMount, cfg.PreflightRole, jwt)
+	if err != nil {
+		db.Status.MarkVaultConfigUnverified("PreflightFailed", "failed to log in as %q: %v", cfg.PreflightRole, err)
+		return
+	}
+	token := login.ClientToken
+	defer func() {
+		if err := client.RevokeSelf(ctx, token); err != nil {
+			logging.FromContext(ctx).Warnw("Failed to revoke the preflight Vault token", zap.Error(err))
+		}
+	}()
+
+	mounts, err := client.AuthMounts(ctx, token)
+	if err != nil {
+		db.Status.MarkVaultConfigUnverified("PreflightFailed", "failed to list auth methods: %v", err)
+		return
+	}
+	mount := strings.Trim(db.Spec.AuthMount, "/")
+	if typ, ok := mounts[mount]; !ok {
+		db.Status.MarkVaultConfigUnverified("AuthMountNotFound", "no auth method is mounted at %q", mount)
+		return
+	} else if typ != "kubernetes" {
+		db.Status.MarkVaultConfigUnverified("AuthMountNotKubernetes",
+			"the auth method mounted at %q is of type %q, not kubernetes", mount, typ)
+		return
+	}
+
+	_, err = client.RolePolicies(ctx, token, mount, db.Spec.VaultAuthRole)
+	if errors.Is(err, vault.ErrNotFound) {
+		db.Status.MarkVaultConfigUnverified("RoleNotFound",
+			"the auth method mounted at %q has no role %q", mount, db.Spec.VaultAuthRole)
+		return
+	} else if err != nil {
+		db.Status.MarkVaultConfigUnverified("PreflightFailed", "failed to read role %q: %v", db.Spec.VaultAuthRole, err)
+		return
+	}
+
+	if serviceAccount == "" {
+		db.Status.MarkVaultConfigUnverified("AwaitingSubjects",
+			"no subject to log in to Vault as, to verify the secrets %q may read", db.Spec.VaultAuthRole)
+		return
+	}
+	roleToken, err := r.loginAsSubjects(ctx, client, db, serviceAccount)
+	if err != nil {
+		db.Status.MarkVaultConfigUnverified("RoleLoginFailed", "failed to log in as %q with service account %q: %v",
+			db.Spec.VaultAuthRole, serviceAccount, err)
+		return
+	}
+
+	// Following the secret versions reads their metadata, which the
+	// policies granting daytona the data don't necessarily grant.
+	var paths, metadata []string
+	for _, p := range db.SecretPaths() {
+		data, err := vault.DataPath(p)
+		if err != nil {
+			db.Status.MarkVaultConfigUnverified("InvalidSecretPath", "%v", err)
+			return
+		}
+		meta, err := vault.MetadataPath(p)
+		if err != nil {
+			db.Status.MarkVaultConfigUnverified("InvalidSecretPath", "%v", err)
+			return
+		}
+		paths = append(paths, data)
+		metadata = append(metadata, meta)
+	}
+	if len(paths) == 0 {
+		db.Status.MarkVaultConfigVerified()
+		return
+	}
+	caps, err := client.Capabilities(ctx, roleToken, append(paths, metadata...))
+	if errors.Is(err, vault.ErrPermissionDenied) {
+		// The token may have been revoked since we logged in.
+		r.forgetToken(ctx, db)
+	}
+	if err != nil {
+		db.Status.MarkVaultConfigUnverified("PreflightFailed", "failed to read the capabilities of %q: %v",
+			db.Spec.VaultAuthRole, err)
+		return
+	}
+	for _, p := range paths {
+		if !vault.CanRead(caps[p]) {
+			db.Status.MarkVaultConfigUnverified("SecretNotReadable",
+				"role %q may not read %s, its capabilities are %v", db.Spec.VaultAuthRole, p, caps[p])
+			return
+		}
+	}
+	for _, p := range metadata {
+		if !vault.CanRead(caps[p]) {
+			db.Status.MarkVaultConfigUnverified("SecretMetadataNotReadable",
+				"role %q may not read %s, which following the secret versions requires, its capabilities are %v",
+				db.Spec.VaultAuthRole, p, caps[p])
+			return
+		}
+	}
+	db.Status.MarkVaultConfigVerified()
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/tracker"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/vault"
+	"github.com/dgerd/daytona-binding/pkg/vault/vaulttest"
+)
+
+func TestReconcilePreflight(t *testing.T) {
+	s := vaulttest.NewServer(t, "kubernetes", "controller", "controller-jwt")
+	s.SetRole("app-role", "app-jwt", "app")
+	s.SetRole("other-role", "app-jwt", "other", "missing")
+	s.SetRole("denied-role", "app-jwt", "app", "denied")
+	s.SetRole("foreign-role", "other-jwt", "app")
+	s.SetRole("data-only-role", "app-jwt", "data-only")
+	s.SetCapabilities("app", "secret/data/app", "read", "list")
+	s.SetCapabilities("app", "secret/metadata/app", "read")
+	s.SetCapabilities("other", "secret/data/other", "read")
+	s.SetCapabilities("denied", "secret/data/app", "deny")
+	s.SetCapabilities("data-only", "secret/data/app", "read")
+
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{
+			VaultAddress:       s.URL,
+			PreflightRole:      "controller",
+			PreflightAuthMount: "kubernetes",
+		},
+	})
+	r := &Reconciler{
+		NewVault: func(address string) vault.Client {
+			return vault.NewClient(address, http.DefaultClient)
+		},
+		serviceAccountToken: func(namespace, name string) (string, error) {
+			return map[string]string{"app": "app-jwt", "other": "other-jwt"}[name], nil
+		},
+	}
+
+	binding := func(mutate func(*v1alpha1.DaytonaBindingSpec)) *v1alpha1.DaytonaBinding {
+		db := &v1alpha1.DaytonaBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "app",
+			},
+			Spec: v1alpha1.DaytonaBindingSpec{
+				Subject:         tracker.Reference{APIVersion: "v1", Kind: "Pod", Namespace: "default"},
+				Auth:            "true",
+				AuthMount:       "kubernetes",
+				VaultAuthRole:   "app-role",
+				VaultSecretsApp: "secret/app",
+			},
+		}
+		if mutate != nil {
+			mutate(&db.Spec)
+		}
+		return db
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		token      error
+		noSubjects bool
+		db         *v1alpha1.DaytonaBinding
+		wantStatus corev1.ConditionStatus
+		wantReason string
+	}{{
+		name:       "verified",
+		ctx:        ctx,
+		db:         binding(nil),
+		wantStatus: corev1.ConditionTrue,
+	}, {
+		name: "missing auth mount",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.AuthMount = "kubernetes-typo"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "AuthMountNotFound",
+	}, {
+		name: "missing role",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.VaultAuthRole = "app-rolw"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "RoleNotFound",
+	}, {
+		name: "unreadable secret",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.VaultAuthRole = "other-role"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretNotReadable",
+	}, {
+		name: "unreadable global secret",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.VaultSecretsGlobal = "secret/global"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretNotReadable",
+	}, {
+		name: "denied secret",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.VaultAuthRole = "denied-role"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretNotReadable",
+	}, {
+		name: "unreadable secret metadata",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.VaultAuthRole = "data-only-role"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretMetadataNotReadable",
+	}, {
+		name: "role not bound to the subjects' service account",
+		ctx:  ctx,
+		db: binding(func(s *v1alpha1.DaytonaBindingSpec) {
+			s.VaultAuthRole = "foreign-role"
+		}),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "RoleLoginFailed",
+	}, {
+		name:       "no subjects",
+		ctx:        ctx,
+		noSubjects: true,
+		db:         binding(nil),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "AwaitingSubjects",
+	}, {
+		name:       "controller can't log in",
+		ctx:        ctx,
+		token:      errors.New("no token"),
+		db:         binding(nil),
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "PreflightFailed",
+	}, {
+		name: "disabled",
+		ctx:  context.Background(),
+		db:   binding(nil),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r.controllerToken = func() (string, error) {
+				return "controller-jwt", test.token
+			}
+			sa := "app"
+			if test.noSubjects {
+				sa = ""
+			}
+			r.reconcilePreflight(test.ctx, test.db, sa)
+
+			c := test.db.Status.GetCondition(v1alpha1.DaytonaBindingConditionVaultConfigVerified)
+			if test.wantStatus == "" {
+				if c != nil {
+					t.Errorf("VaultConfigVerified = %v, want none", c)
+				}
+				return
+			}
+			if c == nil || c.Status != test.wantStatus || c.Reason != test.wantReason {
+				t.Errorf("VaultConfigVerified = %v, want %s %s", c, test.wantStatus, test.wantReason)
+			}
+			if c := test.db.Status.GetCondition(v1alpha1.DaytonaBindingConditionReady); c != nil {
+				t.Errorf("Ready = %v, want unset", c)
+			}
+		})
+	}
+
+	// The controller's tokens are revoked, only the subjects' is kept.
+	if got := s.Tokens(); got != 1 {
+		t.Errorf("Tokens() = %d, want 1", got)
+	}
+}
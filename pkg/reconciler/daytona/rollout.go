@@ -0,0 +1,293 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/logging"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// owner is the controller of a stale subject.
+type owner struct {
+	namespace string
+	ref       metav1.OwnerReference
+}
+
+// workload is a Deployment, StatefulSet or DaemonSet owning stale subjects.
+type workload struct {
+	resource  schema.GroupVersionResource
+	kind      string
+	namespace string
+	name      string
+
+	// annotations of the workload's Pod template.
+	annotations map[string]string
+}
+
+func (w *workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.kind, w.namespace, w.name)
+}
+
+// reconcileRollout restarts the workloads owning stale subjects, when the
+// binding's rollout policy asks for it, and reports those whose rollout is
+// stuck.
+func (r *Reconciler) reconcileRollout(ctx context.Context, db *v1alpha1.DaytonaBinding, owners []owner) error {
+	if db.Spec.RolloutPolicy != v1alpha1.RolloutPolicyRestartOwners {
+		db.Status.ClearRolloutsProgressing()
+		return nil
+	}
+	if len(owners) == 0 {
+		db.Status.MarkRolloutsProgressing()
+		return nil
+	}
+
+	ws, err := r.resolveOwners(owners)
+	if err != nil {
+		return err
+	}
+
+	max := 1
+	if m := db.Spec.MaxConcurrentRollouts; m != nil {
+		max = int(*m)
+	}
+	cfg := config.FromContextOrDefaults(ctx).Daytona
+	hash, now := rolloutHash(db), time.Now()
+	restart, stuck, retryAfter := planRollouts(ws, hash, max, cfg.RolloutInterval, cfg.RolloutDeadline, now)
+
+	if len(stuck) == 0 {
+		db.Status.MarkRolloutsProgressing()
+	} else {
+		names := make([]string, 0, len(stuck))
+		for _, w := range stuck {
+			names = append(names, w.String())
+		}
+		previous := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionRolloutsProgressing)
+		db.Status.MarkRolloutsStuck(names, cfg.RolloutDeadline)
+		if current := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionRolloutsProgressing); previous == nil || previous.Message != current.Message {
+			r.Recorder.Eventf(db, corev1.EventTypeWarning, "RolloutStuck", "%s", current.Message)
+		}
+	}
+
+	for _, w := range restart {
+		if err := r.restart(w, hash, now); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", w, err)
+		}
+		logging.FromContext(ctx).Infof("Restarted %s to roll out configuration %s", w, hash)
+		r.Recorder.Eventf(db, corev1.EventTypeNormal, "RolloutStarted",
+			"Restarted %s to pick up the current configuration", w)
+	}
+
+	// Nothing changes on the subjects of a rate limited workload, nor on
+	// those of a workload that never finishes rolling out, so come back
+	// once its restart is allowed or its deadline passed.
+	if retryAfter > 0 && r.enqueueAfter != nil {
+		r.enqueueAfter(db, retryAfter)
+	}
+	return nil
+}
+
+// resolveOwners maps the controllers of stale subjects onto the distinct
+// workloads that can be restarted to recreate them. Subjects owned by
+// anything else, e.g. a Job or a bare ReplicaSet, are left alone.
+func (r *Reconciler) resolveOwners(owners []owner) ([]*workload, error) {
+	seen := make(map[string]*workload, len(owners))
+	for _, o := range owners {
+		w, err := r.resolveOwner(o.namespace, o.ref)
+		if apierrs.IsNotFound(err) {
+			// The owner is going away, and its subjects with it.
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if w != nil {
+			seen[w.String()] = w
+		}
+	}
+
+	ws := make([]*workload, 0, len(seen))
+	for _, w := range seen {
+		ws = append(ws, w)
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		return ws[i].String() < ws[j].String()
+	})
+	return ws, nil
+}
+
+func (r *Reconciler) resolveOwner(namespace string, ref metav1.OwnerReference) (*workload, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != appsv1.GroupName {
+		return nil, nil
+	}
+
+	switch ref.Kind {
+	case "ReplicaSet":
+		rs, err := r.ReplicaSetLister.ReplicaSets(namespace).Get(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ref := metav1.GetControllerOf(rs); ref != nil && ref.Kind == "Deployment" {
+			return r.resolveOwner(namespace, *ref)
+		}
+		return nil, nil
+
+	case "Deployment":
+		d, err := r.DeploymentLister.Deployments(namespace).Get(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &workload{
+			resource:    appsv1.SchemeGroupVersion.WithResource("deployments"),
+			kind:        ref.Kind,
+			namespace:   namespace,
+			name:        d.Name,
+			annotations: d.Spec.Template.Annotations,
+		}, nil
+
+	case "StatefulSet":
+		ss, err := r.StatefulSetLister.StatefulSets(namespace).Get(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &workload{
+			resource:    appsv1.SchemeGroupVersion.WithResource("statefulsets"),
+			kind:        ref.Kind,
+			namespace:   namespace,
+			name:        ss.Name,
+			annotations: ss.Spec.Template.Annotations,
+		}, nil
+
+	case "DaemonSet":
+		ds, err := r.DaemonSetLister.DaemonSets(namespace).Get(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &workload{
+			resource:    appsv1.SchemeGroupVersion.WithResource("daemonsets"),
+			kind:        ref.Kind,
+			namespace:   namespace,
+			name:        ds.Name,
+			annotations: ds.Spec.Template.Annotations,
+		}, nil
+	}
+	return nil, nil
+}
+
+// planRollouts returns the workloads to restart now so that at most max of
+// them are rolling out the configuration with the given hash at once, and
+// none is restarted more often than once per interval. Workloads restarted
+// for the hash more than deadline ago that still own stale subjects are
+// stuck: they are returned as such, and no longer count as rolling out. It
+// also returns how long until a workload held back by the interval may go,
+// or until a rolling out workload is due, whichever comes first.
+func planRollouts(ws []*workload, hash string, max int, interval, deadline time.Duration, now time.Time) ([]*workload, []*workload, time.Duration) {
+	var (
+		restart, stuck []*workload
+		retryAfter     time.Duration
+	)
+	wakeUp := func(wait time.Duration) {
+		if retryAfter == 0 || wait < retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	// Workloads we already restarted for this hash, which still own stale
+	// subjects, are rolling out until their deadline.
+	inflight := 0
+	for _, w := range ws {
+		if w.annotations[daytona.RestartedForAnnotation] != hash {
+			continue
+		}
+		last, err := time.Parse(time.RFC3339, w.annotations[daytona.RestartedAtAnnotation])
+		if err != nil {
+			// Someone else's doing, we can't tell how long ago.
+			inflight++
+			continue
+		}
+		if due := last.Add(deadline).Sub(now); due > 0 {
+			inflight++
+			wakeUp(due)
+		} else {
+			stuck = append(stuck, w)
+		}
+	}
+
+	for _, w := range ws {
+		if inflight+len(restart) >= max {
+			break
+		}
+		if w.annotations[daytona.RestartedForAnnotation] == hash {
+			continue
+		}
+		if last, err := time.Parse(time.RFC3339, w.annotations[daytona.RestartedAtAnnotation]); err == nil {
+			if wait := last.Add(interval).Sub(now); wait > 0 {
+				wakeUp(wait)
+				continue
+			}
+		}
+		restart = append(restart, w)
+	}
+	return restart, stuck, retryAfter
+}
+
+// rolloutHash identifies what a restart rolls out: the binding's current
+// configuration and, when they rotated, its secrets.
+func rolloutHash(db *v1alpha1.DaytonaBinding) string {
+	hash := db.ConfigHash()
+	if t := db.Status.SecretsRotatedAt; t != nil {
+		hash += "-" + strconv.FormatInt(t.Unix(), 10)
+	}
+	return hash
+}
+
+// restart updates the Pod template annotations of the workload, which has
+// its controller recreate its Pods, as "kubectl rollout restart" does.
+func (r *Reconciler) restart(w *workload, hash string, now time.Time) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						daytona.RestartedAtAnnotation:  now.UTC().Format(time.RFC3339),
+						daytona.RestartedForAnnotation: hash,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.DynamicClient.Resource(w.resource).Namespace(w.namespace).Patch(
+		w.name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
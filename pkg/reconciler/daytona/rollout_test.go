@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+func controlledBy(kind, name string) []metav1.OwnerReference {
+	return []metav1.OwnerReference{*metav1.NewControllerRef(&metav1.ObjectMeta{Name: name},
+		appsv1.SchemeGroupVersion.WithKind(kind))}
+}
+
+func TestResolveOwners(t *testing.T) {
+	indexer := func(objs ...interface{}) cache.Indexer {
+		i := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, obj := range objs {
+			i.Add(obj)
+		}
+		return i
+	}
+	meta := func(name string, refs []metav1.OwnerReference) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "default", Name: name, OwnerReferences: refs}
+	}
+	r := &Reconciler{
+		DeploymentLister: appsv1listers.NewDeploymentLister(indexer(
+			&appsv1.Deployment{ObjectMeta: meta("web", nil)},
+		)),
+		ReplicaSetLister: appsv1listers.NewReplicaSetLister(indexer(
+			&appsv1.ReplicaSet{ObjectMeta: meta("web-1", controlledBy("Deployment", "web"))},
+			&appsv1.ReplicaSet{ObjectMeta: meta("web-2", controlledBy("Deployment", "web"))},
+			&appsv1.ReplicaSet{ObjectMeta: meta("bare", nil)},
+		)),
+		StatefulSetLister: appsv1listers.NewStatefulSetLister(indexer(
+			&appsv1.StatefulSet{ObjectMeta: meta("db", nil)},
+		)),
+		DaemonSetLister: appsv1listers.NewDaemonSetLister(indexer()),
+	}
+
+	var owners []owner
+	for _, refs := range [][]metav1.OwnerReference{
+		controlledBy("ReplicaSet", "web-1"),
+		controlledBy("ReplicaSet", "web-2"),
+		controlledBy("ReplicaSet", "bare"),
+		controlledBy("StatefulSet", "db"),
+		// Deleted owners are skipped.
+		controlledBy("DaemonSet", "gone"),
+		// As are the kinds we don't know how to restart.
+		{{APIVersion: "batch/v1", Kind: "Job", Name: "once"}},
+	} {
+		owners = append(owners, owner{namespace: "default", ref: refs[0]})
+	}
+
+	ws, err := r.resolveOwners(owners)
+	if err != nil {
+		t.Fatalf("resolveOwners() = %v", err)
+	}
+	var got []string
+	for _, w := range ws {
+		got = append(got, w.String())
+	}
+	want := []string{"Deployment default/web", "StatefulSet default/db"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("resolveOwners() (-want, +got) = %s", diff)
+	}
+}
+
+func TestPlanRollouts(t *testing.T) {
+	const hash = "current"
+	now := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	w := func(name string, annotations map[string]string) *workload {
+		return &workload{kind: "Deployment", namespace: "default", name: name, annotations: annotations}
+	}
+	inflight := w("inflight", map[string]string{
+		daytona.RestartedForAnnotation: hash,
+		daytona.RestartedAtAnnotation:  now.Add(-time.Minute).Format(time.RFC3339),
+	})
+	recent := w("recent", map[string]string{
+		daytona.RestartedForAnnotation: "previous",
+		daytona.RestartedAtAnnotation:  now.Add(-2 * time.Minute).Format(time.RFC3339),
+	})
+	old := w("old", map[string]string{
+		daytona.RestartedForAnnotation: "previous",
+		daytona.RestartedAtAnnotation:  now.Add(-time.Hour).Format(time.RFC3339),
+	})
+	stuck := w("stuck", map[string]string{
+		daytona.RestartedForAnnotation: hash,
+		daytona.RestartedAtAnnotation:  now.Add(-time.Hour).Format(time.RFC3339),
+	})
+	fresh1, fresh2 := w("fresh1", nil), w("fresh2", nil)
+
+	tests := []struct {
+		name      string
+		ws        []*workload
+		max       int
+		want      []*workload
+		wantStuck []*workload
+		wantRetry time.Duration
+	}{{
+		name: "capped by max",
+		ws:   []*workload{fresh1, fresh2},
+		max:  1,
+		want: []*workload{fresh1},
+	}, {
+		name:      "inflight counts against max",
+		ws:        []*workload{inflight, fresh1, fresh2},
+		max:       2,
+		want:      []*workload{fresh1},
+		wantRetry: 14 * time.Minute,
+	}, {
+		name:      "nothing while max are inflight",
+		ws:        []*workload{inflight, fresh1},
+		max:       1,
+		wantRetry: 14 * time.Minute,
+	}, {
+		name:      "stuck releases its slot",
+		ws:        []*workload{stuck, fresh1},
+		max:       1,
+		want:      []*workload{fresh1},
+		wantStuck: []*workload{stuck},
+	}, {
+		name:      "rate limited",
+		ws:        []*workload{recent, old, fresh1},
+		max:       2,
+		want:      []*workload{old, fresh1},
+		wantRetry: 3 * time.Minute,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, gotStuck, retry := planRollouts(test.ws, hash, test.max, 5*time.Minute, 15*time.Minute, now)
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(workload{})); diff != "" {
+				t.Errorf("planRollouts() (-want, +got) = %s", diff)
+			}
+			if diff := cmp.Diff(test.wantStuck, gotStuck, cmp.AllowUnexported(workload{})); diff != "" {
+				t.Errorf("planRollouts() stuck (-want, +got) = %s", diff)
+			}
+			if retry != test.wantRetry {
+				t.Errorf("planRollouts() retry = %v, want %v", retry, test.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/logging"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/vault"
+)
+
+// secretVersionsClusterRole is the ClusterRole allowing the controller to
+// create tokens for the service accounts of a namespace, which it must be
+// granted in the namespaces whose bindings follow secret versions.
+const secretVersionsClusterRole = "binding-system-secret-versions"
+
+// reconcileSecretVersions records the current version of the Vault secrets
+// the binding injects, polling Vault on every reconcile. A change from the
+// versions seen last is recorded as a rotation, which marks the subjects
+// created before it as stale and so rolls out the rotated secrets. The first
+// versions seen are not a rotation, as the subjects may well read them.
+func (r *Reconciler) reconcileSecretVersions(ctx context.Context, db *v1alpha1.DaytonaBinding, serviceAccount string) error {
+	cfg := config.FromContextOrDefaults(ctx).Daytona
+	if cfg.VaultAddress == "" {
+		db.Status.LastSecretVersion = nil
+		db.Status.SecretsRotatedAt = nil
+		r.forgetToken(ctx, db)
+		return nil
+	}
+	if r.enqueueAfter != nil {
+		defer r.enqueueAfter(db, cfg.SecretPollInterval)
+	}
+
+	// We can only log in the way daytona does when it uses Kubernetes
+	// auth, and need a subject to borrow the service account of.
+	paths := db.SecretPaths()
+	if auth, _ := strconv.ParseBool(db.Spec.Auth); !auth || serviceAccount == "" || len(paths) == 0 {
+		return nil
+	}
+	client := r.NewVault(cfg.VaultAddress)
+	token, err := r.loginAsSubjects(ctx, client, db, serviceAccount)
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]int64, len(paths))
+	for _, p := range paths {
+		v, err := client.SecretVersion(ctx, token, p)
+		if errors.Is(err, vault.ErrPermissionDenied) {
+			// The token may have been revoked since we logged in.
+			r.forgetToken(ctx, db)
+			return err
+		} else if err != nil {
+			return err
+		}
+		versions[p] = v
+	}
+
+	if db.Status.LastSecretVersion != nil && !equality.Semantic.DeepEqual(db.Status.LastSecretVersion, versions) {
+		logging.FromContext(ctx).Infof("Secret versions changed from %v to %v", db.Status.LastSecretVersion, versions)
+		r.Recorder.Eventf(db, corev1.EventTypeNormal, "SecretRotated",
+			"Secret versions changed to %v", versions)
+		now := metav1.Now()
+		db.Status.SecretsRotatedAt = &now
+	}
+	db.Status.LastSecretVersion = versions
+	return nil
+}
+
+// recordVersionCheck emits a SecretVersionCheckFailed Event when checking
+// the secret versions of the binding failed, unless the previous check
+// failed the same way: it is retried every poll, and every reconcile.
+func (r *Reconciler) recordVersionCheck(db *v1alpha1.DaytonaBinding, err error) {
+	key := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	if err == nil {
+		r.versionChecks.Delete(key)
+		return
+	}
+	if last, ok := r.versionChecks.Load(key); ok && last.(string) == err.Error() {
+		return
+	}
+	r.versionChecks.Store(key, err.Error())
+	r.Recorder.Eventf(db, corev1.EventTypeWarning, "SecretVersionCheckFailed",
+		"Failed to check secret versions: %v", err)
+}
+
+// cachedToken is the Vault token we logged in with as the subjects of a
+// binding, and what we logged in with, a change of which calls for another.
+type cachedToken struct {
+	address        string
+	mount          string
+	role           string
+	serviceAccount string
+
+	token string
+
+	// renewAt is when the token is close enough to expiring to be
+	// replaced, zero when it doesn't expire.
+	renewAt time.Time
+}
+
+// loginAsSubjects logs in to Vault the way daytona does in the binding's
+// subjects, with a token for their service account. Every reconcile would
+// otherwise leave a token in Vault's token store, so the Vault token is
+// reused until two thirds of its TTL have passed, and the one it replaces
+// is revoked.
+func (r *Reconciler) loginAsSubjects(ctx context.Context, client vault.Client, db *v1alpha1.DaytonaBinding, serviceAccount string) (string, error) {
+	// Validation keeps the subjects in the binding's namespace, but not of
+	// the bindings stored before it did. Never mint a token for another
+	// namespace's service account on behalf of a binding.
+	if db.Spec.Subject.Namespace != db.Namespace {
+		return "", fmt.Errorf("subjects in namespace %q aren't in the binding's namespace", db.Spec.Subject.Namespace)
+	}
+
+	key := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	ct := cachedToken{
+		address:        config.FromContextOrDefaults(ctx).Daytona.VaultAddress,
+		mount:          db.Spec.AuthMount,
+		role:           db.Spec.VaultAuthRole,
+		serviceAccount: serviceAccount,
+	}
+	if v, ok := r.tokens.Load(key); ok {
+		cached := v.(cachedToken)
+		if cached.address == ct.address && cached.mount == ct.mount && cached.role == ct.role &&
+			cached.serviceAccount == ct.serviceAccount && (cached.renewAt.IsZero() || time.Now().Before(cached.renewAt)) {
+			return cached.token, nil
+		}
+	}
+
+	jwt, err := r.serviceAccountToken(db.Spec.Subject.Namespace, serviceAccount)
+	if apierrs.IsForbidden(err) {
+		return "", fmt.Errorf("failed to create a token for service account %q, which requires a RoleBinding to the %s ClusterRole in namespace %q: %w",
+			serviceAccount, secretVersionsClusterRole, db.Namespace, err)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to create a token for service account %q: %w", serviceAccount, err)
+	}
+	login, err := client.Login(ctx, db.Spec.AuthMount, db.Spec.VaultAuthRole, jwt)
+	if err != nil {
+		return "", err
+	}
+	ct.token = login.ClientToken
+	if login.TTL > 0 {
+		ct.renewAt = time.Now().Add(login.TTL * 2 / 3)
+	}
+	r.forgetToken(ctx, db)
+	r.tokens.Store(key, ct)
+	return ct.token, nil
+}
+
+// forgetToken revokes the Vault token we logged in with as the subjects of
+// the binding, if any.
+func (r *Reconciler) forgetToken(ctx context.Context, db *v1alpha1.DaytonaBinding) {
+	key := types.NamespacedName{Namespace: db.Namespace, Name: db.Name}
+	v, ok := r.tokens.Load(key)
+	if !ok {
+		return
+	}
+	r.tokens.Delete(key)
+	ct := v.(cachedToken)
+	if err := r.NewVault(ct.address).RevokeSelf(ctx, ct.token); err != nil {
+		logging.FromContext(ctx).Warnw("Failed to revoke the Vault token of the subjects", zap.Error(err))
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/tracker"
+	"knative.dev/pkg/webhook/podbinding"
+
+	"github.com/dgerd/daytona-binding/pkg/apis/config"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+	"github.com/dgerd/daytona-binding/pkg/vault"
+	"github.com/dgerd/daytona-binding/pkg/vault/vaulttest"
+)
+
+func TestReconcileSecretVersions(t *testing.T) {
+	s := vaulttest.NewServer(t, "kubernetes", "app-role", "app-jwt")
+	s.SetVersion("secret/metadata/app", 1)
+	s.SetVersion("secret/metadata/global", 7)
+
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{VaultAddress: s.URL},
+	})
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{Recorder: recorder},
+		NewVault: func(address string) vault.Client {
+			return vault.NewClient(address, http.DefaultClient)
+		},
+		serviceAccountToken: func(namespace, name string) (string, error) {
+			if name == "forbidden" {
+				return "", apierrs.NewForbidden(schema.GroupResource{Resource: "serviceaccounts/token"}, name, errors.New("no RoleBinding"))
+			}
+			return map[string]string{"app": "app-jwt"}[name], nil
+		},
+	}
+
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject:            tracker.Reference{APIVersion: "v1", Kind: "Pod", Namespace: "default"},
+			Image:              "gcr.io/dangerd-dev/daytona:1.2",
+			Auth:               "true",
+			AuthMount:          "kubernetes",
+			VaultAuthRole:      "app-role",
+			VaultSecretsApp:    "secret/app",
+			VaultSecretsGlobal: "secret/data/global",
+		},
+	}
+	before := db.ConfigHash()
+
+	if err := r.reconcileSecretVersions(ctx, db, "app"); err != nil {
+		t.Fatalf("reconcileSecretVersions() = %v", err)
+	}
+	want := map[string]int64{"secret/app": 1, "secret/data/global": 7}
+	if diff := cmp.Diff(want, db.Status.LastSecretVersion); diff != "" {
+		t.Errorf("LastSecretVersion (-want, +got) = %s", diff)
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("Recorded %q on the first poll", <-recorder.Events)
+	}
+	// The subjects may well read the first versions we see.
+	if db.Status.SecretsRotatedAt != nil || db.ConfigHash() != before {
+		t.Errorf("SecretsRotatedAt = %v on the first poll, want nil and the same ConfigHash()", db.Status.SecretsRotatedAt)
+	}
+
+	// Rotating a secret is recorded, for the subjects created before it
+	// to be stale.
+	s.SetVersion("secret/metadata/app", 2)
+	if err := r.reconcileSecretVersions(ctx, db, "app"); err != nil {
+		t.Fatalf("reconcileSecretVersions() = %v", err)
+	}
+	if got := db.Status.LastSecretVersion["secret/app"]; got != 2 {
+		t.Errorf("LastSecretVersion[secret/app] = %d, want 2", got)
+	}
+	if db.Status.SecretsRotatedAt == nil {
+		t.Error("SecretsRotatedAt = nil after a rotation")
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("Recorded %d events, want 1 SecretRotated", len(recorder.Events))
+	}
+
+	// Failing to log in keeps the versions we last saw.
+	if err := r.reconcileSecretVersions(ctx, db, "other"); err == nil {
+		t.Error("reconcileSecretVersions() with the wrong service account = nil, wanted error")
+	}
+	if got := db.Status.LastSecretVersion["secret/app"]; got != 2 {
+		t.Errorf("LastSecretVersion[secret/app] = %d, want 2", got)
+	}
+
+	// The controller is told how to be allowed to mint tokens.
+	if err := r.reconcileSecretVersions(ctx, db, "forbidden"); err == nil || !strings.Contains(err.Error(), secretVersionsClusterRole) {
+		t.Errorf("reconcileSecretVersions() = %v, wanted the missing RoleBinding", err)
+	}
+
+	// Tokens are never minted for another namespace.
+	cross := db.DeepCopy()
+	cross.Spec.Subject.Namespace = "kube-system"
+	if err := r.reconcileSecretVersions(ctx, cross, "app"); err == nil {
+		t.Error("reconcileSecretVersions() across namespaces = nil, wanted error")
+	}
+
+	// Disabling the watcher forgets the versions.
+	if err := r.reconcileSecretVersions(context.Background(), db, "app"); err != nil {
+		t.Fatalf("reconcileSecretVersions() = %v", err)
+	}
+	if db.Status.LastSecretVersion != nil || db.Status.SecretsRotatedAt != nil {
+		t.Errorf("LastSecretVersion, SecretsRotatedAt = %v, %v, want nil", db.Status.LastSecretVersion, db.Status.SecretsRotatedAt)
+	}
+}
+
+func TestReconcileSecretVersionsReusesToken(t *testing.T) {
+	s := vaulttest.NewServer(t, "kubernetes", "app-role", "app-jwt")
+	s.TokenTTL = time.Hour
+	s.SetVersion("secret/metadata/app", 1)
+
+	ctx := config.ToContext(context.Background(), &config.Config{
+		Daytona: &config.Daytona{VaultAddress: s.URL},
+	})
+	var minted int
+	r := &Reconciler{
+		BaseReconciler: &podbinding.BaseReconciler{Recorder: record.NewFakeRecorder(10)},
+		NewVault: func(address string) vault.Client {
+			return vault.NewClient(address, http.DefaultClient)
+		},
+		serviceAccountToken: func(namespace, name string) (string, error) {
+			minted++
+			return "app-jwt", nil
+		},
+	}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject:         tracker.Reference{APIVersion: "v1", Kind: "Pod", Namespace: "default"},
+			Image:           "gcr.io/dangerd-dev/daytona:1.2",
+			Auth:            "true",
+			AuthMount:       "kubernetes",
+			VaultAuthRole:   "app-role",
+			VaultSecretsApp: "secret/app",
+		},
+	}
+	reconcile := func(wantMinted, wantTokens int) {
+		t.Helper()
+		if err := r.reconcileSecretVersions(ctx, db, "app"); err != nil {
+			t.Fatalf("reconcileSecretVersions() = %v", err)
+		}
+		if minted != wantMinted || s.Tokens() != wantTokens {
+			t.Errorf("minted, Tokens() = %d, %d, want %d, %d", minted, s.Tokens(), wantMinted, wantTokens)
+		}
+	}
+
+	// The token is reused while it has most of its TTL left.
+	reconcile(1, 1)
+	reconcile(1, 1)
+
+	// Close to its TTL, it is replaced, and revoked.
+	key := types.NamespacedName{Namespace: "default", Name: "binding"}
+	v, _ := r.tokens.Load(key)
+	ct := v.(cachedToken)
+	ct.renewAt = time.Now().Add(-time.Second)
+	r.tokens.Store(key, ct)
+	reconcile(2, 1)
+
+	// A token revoked behind our back is replaced on the next reconcile.
+	v, _ = r.tokens.Load(key)
+	s.Revoke(v.(cachedToken).token)
+	if err := r.reconcileSecretVersions(ctx, db, "app"); err == nil {
+		t.Error("reconcileSecretVersions() with a revoked token = nil, wanted error")
+	}
+	reconcile(3, 1)
+
+	// Changing the role logs in again.
+	s.SetRole("other-role", "app-jwt")
+	db.Spec.VaultAuthRole = "other-role"
+	reconcile(4, 1)
+
+	// Disabling the watcher revokes the token.
+	if err := r.reconcileSecretVersions(context.Background(), db, "app"); err != nil {
+		t.Fatalf("reconcileSecretVersions() = %v", err)
+	}
+	if s.Tokens() != 0 {
+		t.Errorf("Tokens() = %d with the watcher disabled, want 0", s.Tokens())
+	}
+}
+
+func TestRecordVersionCheck(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{BaseReconciler: &podbinding.BaseReconciler{Recorder: recorder}}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+	}
+
+	denied := errors.New("vault GET secret/metadata/app: permission denied")
+	for i, test := range []struct {
+		err  error
+		want int
+	}{
+		{err: denied, want: 1},
+		// Failing the same way on the next poll isn't reported again.
+		{err: denied, want: 0},
+		{err: errors.New("vault is sealed"), want: 1},
+		{err: nil, want: 0},
+		// Once it succeeded, a failure is news again.
+		{err: denied, want: 1},
+	} {
+		r.recordVersionCheck(db, test.err)
+		if got := events(recorder); len(got) != test.want {
+			t.Errorf("#%d: Events = %q, want %d", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/dgerd/daytona-binding/pkg/admission"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+)
+
+// webhookName is the name of the MutatingWebhookConfiguration the webhook
+// programs to intercept the subjects of DaytonaBindings.
+const webhookName = "daytonabindings.webhook.binding.app"
+
+// reconcileWebhook marks whether the webhook intercepts the binding's
+// subjects.  The webhook programs its configuration on its own, so when it
+// lags behind we wait for its update, which resyncs every binding.
+func (r *Reconciler) reconcileWebhook(ctx context.Context, db *v1alpha1.DaytonaBinding) error {
+	mwh, err := r.MWHLister.Get(webhookName)
+	if apierrs.IsNotFound(err) {
+		db.Status.MarkWebhookNotProgrammed("WebhookUnavailable",
+			"MutatingWebhookConfiguration %q doesn't exist", webhookName)
+		return nil
+	} else if err != nil {
+		db.Status.MarkWebhookNotProgrammed("WebhookUnavailable", "%v", err)
+		return err
+	}
+
+	labeled, err := r.labelsNamespaces()
+	if err != nil {
+		db.Status.MarkWebhookNotProgrammed("WebhookUnavailable", "%v", err)
+		return err
+	}
+	if err := admission.Programmed(mwh, db, labeled); err != nil {
+		db.Status.MarkWebhookNotProgrammed("WebhookNotProgrammed", "%v", err)
+		return nil
+	}
+	db.Status.MarkWebhookProgrammed()
+	return nil
+}
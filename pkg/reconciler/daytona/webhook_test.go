@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daytona
+
+import (
+	"context"
+	"testing"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	admissionlisters "k8s.io/client-go/listers/admissionregistration/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/tracker"
+
+	"github.com/dgerd/daytona-binding/pkg/admission"
+	"github.com/dgerd/daytona-binding/pkg/apis/daytonabinding/v1alpha1"
+)
+
+func TestReconcileWebhook(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	labeled := true
+	r := &Reconciler{
+		MWHLister: admissionlisters.NewMutatingWebhookConfigurationLister(indexer),
+		labelsNamespaces: func() (bool, error) {
+			return labeled, nil
+		},
+	}
+	db := &v1alpha1.DaytonaBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "binding"},
+		Spec: v1alpha1.DaytonaBindingSpec{
+			Subject: tracker.Reference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Namespace:  "default",
+				Name:       "app",
+			},
+		},
+	}
+	programmed := func() *admissionregistrationv1beta1.MutatingWebhookConfiguration {
+		return &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: webhookName},
+			Webhooks: []admissionregistrationv1beta1.MutatingWebhook{{
+				Name: "fail." + webhookName,
+				Rules: []admissionregistrationv1beta1.RuleWithOperations{{
+					Rule: admissionregistrationv1beta1.Rule{
+						APIGroups:   []string{"apps"},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"deployments/*"},
+					},
+				}},
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{
+						Key:      admission.NamespaceNameLabel,
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   []string{"default"},
+					}},
+				},
+			}},
+		}
+	}
+	check := func(want string) {
+		t.Helper()
+		if err := r.reconcileWebhook(context.Background(), db); err != nil {
+			t.Fatalf("reconcileWebhook() = %v", err)
+		}
+		c := db.Status.GetCondition(v1alpha1.DaytonaBindingConditionWebhookProgrammed)
+		switch {
+		case c == nil:
+			t.Errorf("WebhookProgrammed is unset, want %s", want)
+		case want == "" && !c.IsTrue():
+			t.Errorf("WebhookProgrammed = %v, want True", c)
+		case want != "" && (!c.IsFalse() || c.Reason != want):
+			t.Errorf("WebhookProgrammed = %v, want False with %s", c, want)
+		}
+	}
+
+	check("WebhookUnavailable")
+
+	mwh := programmed()
+	mwh.Webhooks = nil
+	indexer.Add(mwh)
+	check("WebhookNotProgrammed")
+
+	indexer.Update(programmed())
+	check("")
+
+	// The entry selects the namespace by a label it doesn't have.
+	labeled = false
+	check("WebhookNotProgrammed")
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	podinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/pod"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// NewController returns a new readiness reconciler. This reconciler keeps
+// the secrets-ready readiness gate of the Pods injected with one in sync
+// with the state of their daytona container.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+
+	podInformer := podinformer.Get(ctx)
+
+	c := &Reconciler{
+		KubeClientSet: kubeclient.Get(ctx),
+		Lister:        podInformer.Lister(),
+	}
+	impl := controller.NewImpl(c, logger, "SecretsReady")
+
+	logger.Info("Setting up event handlers")
+
+	podInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: hasReadinessGate,
+		Handler:    controller.HandleAll(impl.Enqueue),
+	})
+
+	return impl
+}
+
+// hasReadinessGate returns whether the object is a Pod gated on the
+// delivery of its secrets.
+func hasReadinessGate(obj interface{}) bool {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return false
+	}
+	for _, rg := range pod.Spec.ReadinessGates {
+		if rg.ConditionType == daytona.SecretsReadyCondition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+// Reconciler implements controller.Reconciler for Pods gated on the
+// delivery of their secrets.
+type Reconciler struct {
+	// KubeClientSet is used to update the status of the Pods.
+	KubeClientSet kubernetes.Interface
+
+	// Lister is used to fetch the Pods we are reconciling.
+	Lister corev1listers.PodLister
+}
+
+// Check that our Reconciler implements controller.Reconciler
+var _ controller.Reconciler = (*Reconciler)(nil)
+
+// Reconcile implements controller.Reconciler
+func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
+	// Convert the namespace/name string into a distinct namespace and name
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("invalid resource key: %s", key)
+		return nil
+	}
+
+	// Get the resource with this namespace/name.
+	original, err := r.Lister.Pods(namespace).Get(name)
+	if apierrs.IsNotFound(err) {
+		// The resource may no longer exist, in which case we stop processing.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !hasReadinessGate(original) {
+		return nil
+	}
+
+	want := secretsReady(original)
+	for _, c := range original.Status.Conditions {
+		if c.Type == want.Type && c.Status == want.Status && c.Reason == want.Reason {
+			// Already up to date.
+			return nil
+		}
+	}
+
+	// Don't modify the informers copy.
+	pod := original.DeepCopy()
+	want.LastTransitionTime = metav1.Now()
+	setCondition(pod, want)
+	if _, err := r.KubeClientSet.CoreV1().Pods(namespace).UpdateStatus(pod); err != nil {
+		return fmt.Errorf("failed to update the %s condition: %w", want.Type, err)
+	}
+	return nil
+}
+
+// secretsReady returns the secrets-ready condition of the Pod, as reported
+// by the status of its daytona container and, once the secrets were
+// delivered, by the readiness of its renewer, which is no longer Ready once
+// it failed to renew them failureThreshold times in a row.
+func secretsReady(pod *corev1.Pod) corev1.PodCondition {
+	cond := corev1.PodCondition{
+		Type:   daytona.SecretsReadyCondition,
+		Status: corev1.ConditionFalse,
+		Reason: "SecretsPending",
+	}
+	if !hasDaytona(pod) {
+		// Pods without a daytona container, e.g. one the binding was
+		// removed from, have nothing to wait on.
+		cond.Status, cond.Reason = corev1.ConditionTrue, "NoDaytona"
+		return cond
+	}
+	if cs := daytona.ContainerStatus(pod); cs != nil && cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0 {
+		cond.Status, cond.Reason = corev1.ConditionTrue, "SecretsDelivered"
+		if !hasRenewer(pod) {
+			return cond
+		}
+		if rs := daytona.RenewerStatus(pod); rs == nil || !rs.Ready {
+			// The renewer isn't Ready until it is first probed, which
+			// only tells that renewal failed once it was.
+			cond.Status, cond.Reason = corev1.ConditionFalse, "SecretsPending"
+			if renewed(pod) {
+				cond.Reason = "RenewalFailed"
+				cond.Message = fmt.Sprintf("the %s sidecar failed to renew the secrets", daytona.RenewerContainerName)
+			}
+		}
+	} else if f := daytona.Failure(pod); f != nil {
+		cond.Reason = "SecretsFailed"
+		cond.Message = fmt.Sprintf("daytona exited with code %d: %s", f.ExitCode, f.Message)
+	}
+	return cond
+}
+
+func hasDaytona(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == daytona.ContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRenewer(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == daytona.RenewerContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+// renewed returns whether the secrets-ready condition of the Pod already
+// reports that the renewer was Ready, or that it failed since.
+func renewed(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == daytona.SecretsReadyCondition {
+			return c.Status == corev1.ConditionTrue || c.Reason == "RenewalFailed"
+		}
+	}
+	return false
+}
+
+// setCondition sets the condition of the Pod, replacing any condition of
+// the same type.
+func setCondition(pod *corev1.Pod, cond corev1.PodCondition) {
+	for i, c := range pod.Status.Conditions {
+		if c.Type == cond.Type {
+			pod.Status.Conditions[i] = cond
+			return
+		}
+	}
+	pod.Status.Conditions = append(pod.Status.Conditions, cond)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/dgerd/daytona-binding/pkg/daytona"
+)
+
+func TestSecretsReady(t *testing.T) {
+	injected := corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: daytona.ContainerName}},
+		ReadinessGates: []corev1.PodReadinessGate{{ConditionType: daytona.SecretsReadyCondition}},
+	}
+	status := func(state, last corev1.ContainerState) corev1.PodStatus {
+		return corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 daytona.ContainerName,
+				State:                state,
+				LastTerminationState: last,
+				RestartCount:         1,
+			}},
+		}
+	}
+	exited := func(code int32) corev1.ContainerState {
+		return corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: code}}
+	}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+
+	renewing := *injected.DeepCopy()
+	renewing.Containers = []corev1.Container{{Name: "app"}, {Name: daytona.RenewerContainerName}}
+	// renewal returns the status of a Pod whose secrets were delivered, and
+	// whose renewer is Ready or not, with the provided prior condition.
+	renewal := func(ready bool, prior *corev1.PodCondition) corev1.PodStatus {
+		s := status(exited(0), corev1.ContainerState{})
+		s.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  daytona.RenewerContainerName,
+			State: running,
+			Ready: ready,
+		}}
+		if prior != nil {
+			s.Conditions = []corev1.PodCondition{*prior}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		pod        corev1.Pod
+		wantStatus corev1.ConditionStatus
+		wantReason string
+	}{{
+		name:       "not started",
+		pod:        corev1.Pod{Spec: injected},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretsPending",
+	}, {
+		name:       "running",
+		pod:        corev1.Pod{Spec: injected, Status: status(running, corev1.ContainerState{})},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretsPending",
+	}, {
+		name:       "delivered",
+		pod:        corev1.Pod{Spec: injected, Status: status(exited(0), corev1.ContainerState{})},
+		wantStatus: corev1.ConditionTrue,
+		wantReason: "SecretsDelivered",
+	}, {
+		name:       "failed",
+		pod:        corev1.Pod{Spec: injected, Status: status(exited(1), corev1.ContainerState{})},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretsFailed",
+	}, {
+		name:       "retrying",
+		pod:        corev1.Pod{Spec: injected, Status: status(running, exited(1))},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretsFailed",
+	}, {
+		name:       "renewer not probed yet",
+		pod:        corev1.Pod{Spec: renewing, Status: renewal(false, nil)},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "SecretsPending",
+	}, {
+		name:       "renewing",
+		pod:        corev1.Pod{Spec: renewing, Status: renewal(true, nil)},
+		wantStatus: corev1.ConditionTrue,
+		wantReason: "SecretsDelivered",
+	}, {
+		name: "renewal failed",
+		pod: corev1.Pod{Spec: renewing, Status: renewal(false, &corev1.PodCondition{
+			Type:   daytona.SecretsReadyCondition,
+			Status: corev1.ConditionTrue,
+			Reason: "SecretsDelivered",
+		})},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "RenewalFailed",
+	}, {
+		name: "still failing",
+		pod: corev1.Pod{Spec: renewing, Status: renewal(false, &corev1.PodCondition{
+			Type:   daytona.SecretsReadyCondition,
+			Status: corev1.ConditionFalse,
+			Reason: "RenewalFailed",
+		})},
+		wantStatus: corev1.ConditionFalse,
+		wantReason: "RenewalFailed",
+	}, {
+		name: "renewal recovered",
+		pod: corev1.Pod{Spec: renewing, Status: renewal(true, &corev1.PodCondition{
+			Type:   daytona.SecretsReadyCondition,
+			Status: corev1.ConditionFalse,
+			Reason: "RenewalFailed",
+		})},
+		wantStatus: corev1.ConditionTrue,
+		wantReason: "SecretsDelivered",
+	}, {
+		name: "no daytona",
+		pod: corev1.Pod{Spec: corev1.PodSpec{
+			ReadinessGates: injected.ReadinessGates,
+		}},
+		wantStatus: corev1.ConditionTrue,
+		wantReason: "NoDaytona",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !hasReadinessGate(&test.pod) {
+				t.Fatal("hasReadinessGate() = false")
+			}
+			got := secretsReady(&test.pod)
+			if got.Type != daytona.SecretsReadyCondition || got.Status != test.wantStatus || got.Reason != test.wantReason {
+				t.Errorf("secretsReady() = %v, want %s %s", got, test.wantStatus, test.wantReason)
+			}
+		})
+	}
+
+	if hasReadinessGate(&corev1.Pod{}) {
+		t.Error("hasReadinessGate() of an ungated Pod = true")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single request to a registry, so that an
+// unresponsive registry can't stall the reconciliation of bindings.
+const DefaultTimeout = 10 * time.Second
+
+// acceptedManifestTypes are the manifest media types we are willing to
+// resolve a tag to.  Indexes are listed so that multi-arch images resolve
+// to the digest of the index rather than a single platform's manifest.
+var acceptedManifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Resolver resolves image tags to the digests they currently point at.
+type Resolver interface {
+	// Resolve returns the provided reference pinned to the digest of the
+	// manifest its tag points at.
+	Resolve(ctx context.Context, ref Reference) (Reference, error)
+}
+
+// NewResolver returns a Resolver that speaks the Docker Registry HTTP API V2
+// over https using the provided client, authenticating anonymously via the
+// registry's token service when challenged.
+func NewResolver(client *http.Client) Resolver {
+	return &resolver{client: client}
+}
+
+type resolver struct {
+	client *http.Client
+}
+
+var _ Resolver = (*resolver)(nil)
+
+// Resolve implements Resolver
+func (r *resolver) Resolve(ctx context.Context, ref Reference) (Reference, error) {
+	if ref.HasDigest() {
+		return ref, nil
+	}
+	tag := ref.Tag
+	if tag == "" {
+		tag = DefaultTag
+	}
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registryHost(ref.Registry), ref.Repository, tag)
+
+	resp, err := r.head(ctx, u, "")
+	if err != nil {
+		return ref, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.token(ctx, resp.Header.Get("WWW-Authenticate"), ref)
+		if err != nil {
+			return ref, err
+		}
+		if resp, err = r.head(ctx, u, token); err != nil {
+			return ref, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ref, fmt.Errorf("unexpected status resolving %s: %s", ref, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if !digestRegexp.MatchString(digest) {
+		return ref, fmt.Errorf("registry returned invalid digest %q for %s", digest, ref)
+	}
+	ref.Digest = digest
+	return ref, nil
+}
+
+func (r *resolver) head(ctx context.Context, u, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(acceptedManifestTypes, ","))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token performs the anonymous token exchange described by a Bearer
+// WWW-Authenticate challenge, returning the resulting token.
+func (r *resolver) token(ctx context.Context, challenge string, ref Reference) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("unsupported authentication challenge %q for %s", challenge, ref)
+	}
+	params := map[string]string{}
+	for _, m := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm in challenge %q for %s", challenge, ref)
+	}
+
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status fetching token for %s: %s", ref, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode token for %s: %w", ref, err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// registryHost maps the canonical Docker Hub name onto its API endpoint.
+func registryHost(registry string) string {
+	if registry == DefaultRegistry {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// newTestRegistry starts an in-process registry that serves a single
+// repository, requiring a bearer token obtained from its own token service.
+func newTestRegistry(t *testing.T, repository string, tags map[string]string) *httptest.Server {
+	var ts *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Query().Get("scope"), fmt.Sprintf("repository:%s:pull", repository); got != want {
+			http.Error(w, "bad scope "+got, http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "let-me-in"})
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer let-me-in" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`, ts.URL, repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		prefix := "/v2/" + repository + "/manifests/"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		digest, ok := tags[strings.TrimPrefix(r.URL.Path, prefix)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	})
+	ts = httptest.NewTLSServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestResolve(t *testing.T) {
+	ts := newTestRegistry(t, "dangerd-dev/daytona", map[string]string{
+		"1.2":    testDigest,
+		"latest": testDigest,
+	})
+	host := strings.TrimPrefix(ts.URL, "https://")
+	r := NewResolver(ts.Client())
+
+	tests := []struct {
+		name    string
+		image   string
+		want    string
+		wantErr bool
+	}{{
+		name:  "tag",
+		image: host + "/dangerd-dev/daytona:1.2",
+		want:  host + "/dangerd-dev/daytona:1.2@" + testDigest,
+	}, {
+		name:  "implicit latest",
+		image: host + "/dangerd-dev/daytona",
+		want:  host + "/dangerd-dev/daytona@" + testDigest,
+	}, {
+		name:  "already pinned",
+		image: host + "/dangerd-dev/other@" + testDigest,
+		want:  host + "/dangerd-dev/other@" + testDigest,
+	}, {
+		name:    "unknown tag",
+		image:   host + "/dangerd-dev/daytona:nope",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := ParseReference(test.image)
+			if err != nil {
+				t.Fatalf("ParseReference() = %v", err)
+			}
+			got, err := r.Resolve(context.Background(), ref)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Resolve() = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && got.String() != test.want {
+				t.Errorf("Resolve() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry assumed for references that do not
+	// name one explicitly, e.g. "ubuntu" or "library/ubuntu".
+	DefaultRegistry = "index.docker.io"
+
+	// DefaultTag is the tag assumed for references that carry neither a
+	// tag nor a digest.
+	DefaultTag = "latest"
+)
+
+var (
+	repositoryRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRegexp        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+)
+
+// Reference is a parsed container image reference.
+type Reference struct {
+	// Registry is the host (and optional port) serving the image.
+	Registry string
+
+	// Repository is the path of the image within the registry.
+	Repository string
+
+	// Tag is the tag of the image, if one was specified.
+	Tag string
+
+	// Digest is the content digest of the image, if one was specified.
+	Digest string
+}
+
+// ParseReference parses an image reference of the form
+// [registry/]repository[:tag][@digest].
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	if s == "" {
+		return ref, fmt.Errorf("image reference is empty")
+	}
+
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !digestRegexp.MatchString(ref.Digest) {
+			return ref, fmt.Errorf("invalid digest %q in image reference %q", ref.Digest, s)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return ref, fmt.Errorf("invalid tag %q in image reference %q", ref.Tag, s)
+		}
+	}
+
+	ref.Registry = DefaultRegistry
+	ref.Repository = name
+	if i := strings.Index(name, "/"); i >= 0 {
+		if host := name[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			ref.Registry, ref.Repository = host, name[i+1:]
+		}
+	}
+	if ref.Registry == DefaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if !repositoryRegexp.MatchString(ref.Repository) {
+		return ref, fmt.Errorf("invalid repository %q in image reference %q", ref.Repository, s)
+	}
+	return ref, nil
+}
+
+// Name returns the fully qualified repository name, without tag or digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// HasDigest returns whether the reference is pinned to a content digest.
+func (r Reference) HasDigest() bool {
+	return r.Digest != ""
+}
+
+// String returns the fully qualified form of the reference.
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
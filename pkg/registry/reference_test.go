@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	const digest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	tests := []struct {
+		name    string
+		in      string
+		want    Reference
+		wantErr bool
+	}{{
+		name: "docker hub short name",
+		in:   "daytona",
+		want: Reference{Registry: DefaultRegistry, Repository: "library/daytona"},
+	}, {
+		name: "docker hub with tag",
+		in:   "cruise/daytona:1.2",
+		want: Reference{Registry: DefaultRegistry, Repository: "cruise/daytona", Tag: "1.2"},
+	}, {
+		name: "registry with port",
+		in:   "localhost:5000/daytona:dev",
+		want: Reference{Registry: "localhost:5000", Repository: "daytona", Tag: "dev"},
+	}, {
+		name: "tag and digest",
+		in:   "gcr.io/dangerd-dev/daytona:1.2@" + digest,
+		want: Reference{Registry: "gcr.io", Repository: "dangerd-dev/daytona", Tag: "1.2", Digest: digest},
+	}, {
+		name: "digest only",
+		in:   "gcr.io/dangerd-dev/daytona@" + digest,
+		want: Reference{Registry: "gcr.io", Repository: "dangerd-dev/daytona", Digest: digest},
+	}, {
+		name:    "empty",
+		in:      "",
+		wantErr: true,
+	}, {
+		name:    "bad digest",
+		in:      "gcr.io/dangerd-dev/daytona@sha256:nothex",
+		wantErr: true,
+	}, {
+		name:    "upper case repository",
+		in:      "gcr.io/Dangerd/daytona",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseReference(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseReference(%q) = %v, wantErr %v", test.in, err, test.wantErr)
+			}
+			if err == nil && got != test.want {
+				t.Errorf("ParseReference(%q) = %#v, want %#v", test.in, got, test.want)
+			}
+		})
+	}
+}
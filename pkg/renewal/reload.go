@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Reloader tells the application that its secrets changed.
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// signals are the signals the renewer may send, by name.
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// Signals returns the names of the signals the renewer may send.
+func Signals() []string {
+	names := make([]string, 0, len(signals))
+	for name := range signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseSignal returns the signal with the provided name, e.g. SIGHUP.
+func ParseSignal(name string) (syscall.Signal, error) {
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("unsupported signal %q, must be one of %v", name, Signals())
+}
+
+// Signaller sends a signal to the main processes of a container of the Pod,
+// which requires the Pod to share its process namespace. The processes of
+// the container are told apart by their environment, which holds the
+// provided Env, so the renewer must run as the same user as them.
+type Signaller struct {
+	// Env is the name=value environment variable of the processes of the
+	// container.
+	Env string
+
+	// Signal is the signal to send.
+	Signal syscall.Signal
+
+	// Proc is where procfs is mounted, /proc unless set.
+	Proc string
+
+	// kill sends the signal, it is stubbed out in tests.
+	kill func(pid int, sig syscall.Signal) error
+}
+
+var _ Reloader = (*Signaller)(nil)
+
+// Reload implements Reloader
+func (s *Signaller) Reload(ctx context.Context) error {
+	proc := s.Proc
+	if proc == "" {
+		proc = "/proc"
+	}
+	kill := s.kill
+	if kill == nil {
+		kill = syscall.Kill
+	}
+
+	// The processes of the container, mapped to their parent.
+	parents := map[int]int{}
+	entries, err := ioutil.ReadDir(proc)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// The processes of other users can't be read, nor signalled.
+		environ, err := ioutil.ReadFile(filepath.Join(proc, e.Name(), "environ"))
+		if err != nil || !hasEnv(environ, s.Env) {
+			continue
+		}
+		ppid, err := parent(filepath.Join(proc, e.Name(), "status"))
+		if err != nil {
+			continue
+		}
+		parents[pid] = ppid
+	}
+
+	var signalled int
+	for pid, ppid := range parents {
+		if _, ok := parents[ppid]; ok {
+			// Only the main processes are signalled, as they may not
+			// expect their children to be.
+			continue
+		}
+		if err := kill(pid, s.Signal); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to signal process %d: %w", pid, err)
+		}
+		signalled++
+	}
+	if signalled == 0 {
+		return fmt.Errorf("found no process with %s to signal", s.Env)
+	}
+	return nil
+}
+
+// hasEnv returns whether the NUL separated environment holds env.
+func hasEnv(environ []byte, env string) bool {
+	for _, e := range bytes.Split(environ, []byte{0}) {
+		if string(e) == env {
+			return true
+		}
+	}
+	return false
+}
+
+// parent returns the PPid listed in the provided /proc/<pid>/status file.
+func parent(status string) (int, error) {
+	f, err := os.Open(status)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v := strings.TrimPrefix(s.Text(), "PPid:"); v != s.Text() {
+			return strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s has no PPid", status)
+}
+
+// HTTPReloader POSTs to a reload endpoint of the application.
+type HTTPReloader struct {
+	// URL is the reload endpoint, e.g. http://localhost:8080/-/reload.
+	URL string
+
+	// Client is the client to POST with.
+	Client *http.Client
+}
+
+var _ Reloader = (*HTTPReloader)(nil)
+
+// Reload implements Reloader
+func (h *HTTPReloader) Reload(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status from %s: %s", h.URL, resp.Status)
+	}
+	return nil
+}
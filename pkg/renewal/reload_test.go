@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSignal(t *testing.T) {
+	if sig, err := ParseSignal("SIGHUP"); err != nil || sig != syscall.SIGHUP {
+		t.Errorf("ParseSignal(SIGHUP) = %v, %v", sig, err)
+	}
+	if _, err := ParseSignal("SIGKILL"); err == nil {
+		t.Error("ParseSignal(SIGKILL) = nil, wanted an error")
+	}
+}
+
+func TestSignaller(t *testing.T) {
+	// process is a process of the fake procfs.
+	type process struct {
+		pid, ppid string
+		environ   string
+	}
+	tests := []struct {
+		name      string
+		processes []process
+		want      []int
+		wantErr   bool
+	}{{
+		name: "main process",
+		processes: []process{
+			{pid: "1", ppid: "0", environ: "PATH=/bin"},
+			{pid: "7", ppid: "1", environ: "HOME=/\x00RELOAD=1\x00"},
+			{pid: "9", ppid: "7", environ: "RELOAD=1\x00"},
+			{pid: "12", ppid: "1", environ: "PATH=/bin"},
+		},
+		want: []int{7},
+	}, {
+		name: "several main processes",
+		processes: []process{
+			{pid: "7", ppid: "1", environ: "RELOAD=1\x00"},
+			{pid: "8", ppid: "1", environ: "RELOAD=1\x00"},
+		},
+		want: []int{7, 8},
+	}, {
+		name: "no process",
+		processes: []process{
+			{pid: "7", ppid: "1", environ: "RELOAD=2\x00"},
+		},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proc, err := ioutil.TempDir("", "proc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(proc)
+			for _, p := range test.processes {
+				dir := filepath.Join(proc, p.pid)
+				if err := os.Mkdir(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, "environ"), []byte(p.environ), 0644); err != nil {
+					t.Fatal(err)
+				}
+				status := "Name:\tapp\nPPid:\t" + p.ppid + "\n"
+				if err := ioutil.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got []int
+			s := &Signaller{
+				Env:    "RELOAD=1",
+				Signal: syscall.SIGHUP,
+				Proc:   proc,
+				kill: func(pid int, sig syscall.Signal) error {
+					if sig != syscall.SIGHUP {
+						t.Errorf("kill(%d, %v), wanted SIGHUP", pid, sig)
+					}
+					got = append(got, pid)
+					return nil
+				},
+			}
+			if err := s.Reload(context.Background()); (err != nil) != test.wantErr {
+				t.Fatalf("Reload() = %v, wantErr %v", err, test.wantErr)
+			}
+			sort.Ints(got)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Signalled (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestHTTPReloader(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{{
+		name:   "reloaded",
+		status: http.StatusNoContent,
+	}, {
+		name:    "failed",
+		status:  http.StatusInternalServerError,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/-/reload" {
+					t.Errorf("Got %s %s, wanted POST /-/reload", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(test.status)
+			}))
+			defer srv.Close()
+
+			h := &HTTPReloader{URL: srv.URL + "/-/reload", Client: srv.Client()}
+			if err := h.Reload(context.Background()); (err != nil) != test.wantErr {
+				t.Errorf("Reload() = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+)
+
+// Renewer runs daytona at an interval to rewrite the secrets, and reloads
+// the application whenever they change.
+type Renewer struct {
+	// Command runs daytona once, e.g. ["daytona"].
+	Command []string
+
+	// Interval is the time between two runs of daytona.
+	Interval time.Duration
+
+	// FailureThreshold is the number of consecutive failed runs after which
+	// the renewer is no longer ready.
+	FailureThreshold int
+
+	// SecretsDir is the directory daytona writes the secrets to, which is
+	// compared before and after each run to tell whether they changed.
+	SecretsDir string
+
+	// Ignore lists the files of SecretsDir that change on every run, such as
+	// the Vault token, and so don't tell whether the secrets changed.
+	Ignore []string
+
+	// ReadyFile exists while the renewer is ready.
+	ReadyFile string
+
+	// Reloader, when set, is told whenever the secrets changed.
+	Reloader Reloader
+
+	// run runs the provided command, it is stubbed out in tests.
+	run func(ctx context.Context, command []string) error
+}
+
+// Run renews the secrets until the context is done. The secrets were written
+// by the daytona init container before the application started, so the
+// renewer is ready from the start.
+func (r *Renewer) Run(ctx context.Context) error {
+	if err := r.markReady(true); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	var failures int
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		failures = r.renew(ctx, failures)
+	}
+}
+
+// renew runs daytona once, and returns the number of consecutive failed
+// runs, given the number of them before.
+func (r *Renewer) renew(ctx context.Context, failures int) int {
+	logger := logging.FromContext(ctx)
+
+	before, err := digest(r.SecretsDir, r.Ignore)
+	if err != nil {
+		logger.Warnw("Failed to read the secrets", zap.Error(err))
+	}
+	run := r.run
+	if run == nil {
+		run = execute
+	}
+	if err := run(ctx, r.Command); err != nil {
+		failures++
+		logger.Warnw("Failed to renew the secrets", zap.Int("failures", failures), zap.Error(err))
+		if failures >= r.FailureThreshold {
+			if err := r.markReady(false); err != nil {
+				logger.Errorw("Failed to mark the renewer unready", zap.Error(err))
+			}
+		}
+		return failures
+	}
+	if err := r.markReady(true); err != nil {
+		logger.Errorw("Failed to mark the renewer ready", zap.Error(err))
+	}
+
+	after, err := digest(r.SecretsDir, r.Ignore)
+	if err != nil {
+		logger.Warnw("Failed to read the secrets", zap.Error(err))
+	} else if after == before {
+		return 0
+	}
+	logger.Info("The secrets changed")
+	if r.Reloader != nil {
+		if err := r.Reloader.Reload(ctx); err != nil {
+			logger.Warnw("Failed to reload the application", zap.Error(err))
+		}
+	}
+	return 0
+}
+
+// markReady creates the ready file, or removes it.
+func (r *Renewer) markReady(ready bool) error {
+	if !ready {
+		if err := os.Remove(r.ReadyFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(r.ReadyFile, nil, 0644)
+}
+
+// Ready returns an error unless the provided ready file exists.
+func Ready(readyFile string) error {
+	if _, err := os.Stat(readyFile); err != nil {
+		return fmt.Errorf("the secrets aren't renewed: %w", err)
+	}
+	return nil
+}
+
+// execute runs the provided command, passing on its output.
+func execute(ctx context.Context, command []string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// digest returns a digest of the names and contents of the files under dir,
+// but those ignored.
+func digest(dir string, ignore []string) (string, error) {
+	ignored := make(map[string]bool, len(ignore))
+	for _, p := range ignore {
+		ignored[filepath.Clean(p)] = true
+	}
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || ignored[path] {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%s\x00", path)
+		_, err = io.Copy(h, f)
+		return err
+	})
+	return fmt.Sprintf("%x", h.Sum(nil)), err
+}
+
+// Install copies the running binary to path, so that it can be run from a
+// container of another image sharing the volume it is written to.
+func Install(path string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(self)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package renewal
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeReloader struct {
+	reloads int
+}
+
+func (f *fakeReloader) Reload(ctx context.Context) error {
+	f.reloads++
+	return nil
+}
+
+func TestRenew(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures is the number of consecutive failed runs before.
+		failures int
+		// fail fails the run, and write rewrites the secret with the
+		// provided content.
+		fail  bool
+		write string
+
+		wantFailures int
+		wantReady    bool
+		wantReloads  int
+	}{{
+		name:      "unchanged",
+		write:     "hunter2",
+		wantReady: true,
+	}, {
+		name:        "changed",
+		write:       "hunter3",
+		wantReady:   true,
+		wantReloads: 1,
+	}, {
+		name:         "failed below the threshold",
+		fail:         true,
+		wantFailures: 1,
+		wantReady:    true,
+	}, {
+		name:         "failed at the threshold",
+		failures:     1,
+		fail:         true,
+		wantFailures: 2,
+	}, {
+		name:        "recovered",
+		failures:    5,
+		write:       "hunter3",
+		wantReady:   true,
+		wantReloads: 1,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "renewer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			secrets := filepath.Join(dir, "secrets")
+			if err := os.Mkdir(secrets, 0755); err != nil {
+				t.Fatal(err)
+			}
+			secret := filepath.Join(secrets, "password")
+			if err := ioutil.WriteFile(secret, []byte("hunter2"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			ready := filepath.Join(dir, "ready")
+			if err := ioutil.WriteFile(ready, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reloader := &fakeReloader{}
+			r := &Renewer{
+				FailureThreshold: 2,
+				SecretsDir:       secrets,
+				ReadyFile:        ready,
+				Reloader:         reloader,
+				run: func(context.Context, []string) error {
+					if test.fail {
+						return errors.New("vault is down")
+					}
+					return ioutil.WriteFile(secret, []byte(test.write), 0644)
+				},
+			}
+
+			if got := r.renew(context.Background(), test.failures); got != test.wantFailures {
+				t.Errorf("renew() = %d, wanted %d", got, test.wantFailures)
+			}
+			if got := Ready(ready) == nil; got != test.wantReady {
+				t.Errorf("Ready() = %v, wanted %v", got, test.wantReady)
+			}
+			if reloader.reloads != test.wantReloads {
+				t.Errorf("Reloads = %d, wanted %d", reloader.reloads, test.wantReloads)
+			}
+		})
+	}
+}
+
+func TestDigestIgnore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("s.1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := digest(dir, []string{token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(token, []byte("s.2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := digest(dir, []string{token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Error("digest() changed with an ignored file")
+	}
+	if changed, err := digest(dir, nil); err != nil || changed == after {
+		t.Errorf("digest() = %v, %v, wanted it to change with the file", changed, err)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single request to Vault, so that an unresponsive
+// Vault can't stall the reconciliation of bindings.
+const DefaultTimeout = 10 * time.Second
+
+// Client is the subset of the Vault API used to follow secret rotations.
+type Client interface {
+	// Login exchanges a Kubernetes service account token for a Vault
+	// token, using the kubernetes auth method mounted at mount.
+	Login(ctx context.Context, mount, role, jwt string) (*Token, error)
+
+	// RevokeSelf revokes the token, once it is no longer used, rather than
+	// leaving it in Vault's token store until it expires.
+	RevokeSelf(ctx context.Context, token string) error
+
+	// SecretVersion returns the current version of the KV v2 secret at
+	// path, e.g. "secret/path/to/app".
+	SecretVersion(ctx context.Context, token, path string) (int64, error)
+
+	// AuthMounts returns the type of each enabled auth method, keyed by
+	// the path it is mounted at, without slashes, e.g. "kubernetes".
+	AuthMounts(ctx context.Context, token string) (map[string]string, error)
+
+	// RolePolicies returns the policies attached to the role of the
+	// kubernetes auth method mounted at mount.
+	RolePolicies(ctx context.Context, token, mount, role string) ([]string, error)
+
+	// Capabilities returns the capabilities the token has on each of the
+	// provided paths, as Vault evaluates its policies.
+	Capabilities(ctx context.Context, token string, paths []string) (map[string][]string, error)
+}
+
+// Token is a Vault token handed out by Login.
+type Token struct {
+	// ClientToken is the token, as sent in the X-Vault-Token header.
+	ClientToken string
+
+	// TTL is how long the token is valid for, zero when it doesn't expire.
+	TTL time.Duration
+}
+
+// ErrNotFound is returned (wrapped) when the requested object does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrPermissionDenied is returned (wrapped) when the token may not make the
+// request, or is no longer valid.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// NewClient returns a Client for the Vault server at address, e.g.
+// https://vault.example.com:8200, using the provided HTTP client.
+func NewClient(address string, client *http.Client) Client {
+	return &httpClient{
+		address: strings.TrimSuffix(address, "/"),
+		client:  client,
+	}
+}
+
+type httpClient struct {
+	address string
+	client  *http.Client
+}
+
+var _ Client = (*httpClient)(nil)
+
+// Login implements Client
+func (c *httpClient) Login(ctx context.Context, mount, role, jwt string) (*Token, error) {
+	body, err := json.Marshal(map[string]string{
+		"role": role,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", "", body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("vault login to %q returned no token", mount)
+	}
+	return &Token{
+		ClientToken: resp.Auth.ClientToken,
+		TTL:         time.Duration(resp.Auth.LeaseDuration) * time.Second,
+	}, nil
+}
+
+// RevokeSelf implements Client
+func (c *httpClient) RevokeSelf(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodPost, "auth/token/revoke-self", token, nil, nil)
+}
+
+// SecretVersion implements Client
+func (c *httpClient) SecretVersion(ctx context.Context, token, path string) (int64, error) {
+	p, err := MetadataPath(path)
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		Data struct {
+			CurrentVersion int64 `json:"current_version"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, p, token, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Data.CurrentVersion, nil
+}
+
+// AuthMounts implements Client
+func (c *httpClient) AuthMounts(ctx context.Context, token string) (map[string]string, error) {
+	var resp struct {
+		Data map[string]struct {
+			Type string `json:"type"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "sys/auth", token, nil, &resp); err != nil {
+		return nil, err
+	}
+	mounts := make(map[string]string, len(resp.Data))
+	for path, m := range resp.Data {
+		mounts[strings.Trim(path, "/")] = m.Type
+	}
+	return mounts, nil
+}
+
+// RolePolicies implements Client
+func (c *httpClient) RolePolicies(ctx context.Context, token, mount, role string) ([]string, error) {
+	var resp struct {
+		Data struct {
+			TokenPolicies []string `json:"token_policies"`
+			Policies      []string `json:"policies"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "auth/"+strings.Trim(mount, "/")+"/role/"+role, token, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data.TokenPolicies) > 0 {
+		return resp.Data.TokenPolicies, nil
+	}
+	// Older versions of Vault only know of policies.
+	return resp.Data.Policies, nil
+}
+
+// Capabilities implements Client
+func (c *httpClient) Capabilities(ctx context.Context, token string, paths []string) (map[string][]string, error) {
+	body, err := json.Marshal(map[string][]string{"paths": paths})
+	if err != nil {
+		return nil, err
+	}
+	// The capabilities of each path are keyed by the path, next to the
+	// union of them all under "capabilities".
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, "sys/capabilities-self", token, body, &resp); err != nil {
+		return nil, err
+	}
+	caps := make(map[string][]string, len(paths))
+	for _, p := range paths {
+		raw, ok := resp.Data[p]
+		if !ok {
+			return nil, fmt.Errorf("vault returned no capabilities for %q", p)
+		}
+		var cs []string
+		if err := json.Unmarshal(raw, &cs); err != nil {
+			return nil, fmt.Errorf("failed to decode the capabilities of %q: %w", p, err)
+		}
+		caps[p] = cs
+	}
+	return caps, nil
+}
+
+// CanRead returns whether the provided capabilities grant read.
+func CanRead(caps []string) bool {
+	var read bool
+	for _, c := range caps {
+		switch c {
+		case "deny":
+			return false
+		case "read", "root":
+			read = true
+		}
+	}
+	return read
+}
+
+// MetadataPath returns the KV v2 metadata endpoint of the secret at path,
+// which may be written with or without the "data/" segment of the KV v2
+// API, e.g. both "secret/app" and "secret/data/app" map to
+// "secret/metadata/app".
+func MetadataPath(path string) (string, error) {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("%q is not of the form <mount>/<path>", path)
+	}
+	return parts[0] + "/metadata/" + strings.TrimPrefix(parts[1], "data/"), nil
+}
+
+// DataPath is like MetadataPath, but returns the KV v2 data endpoint of the
+// secret, which is the path the capabilities to read it are on.
+func DataPath(path string) (string, error) {
+	p, err := MetadataPath(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(p, "/metadata/", "/data/", 1), nil
+}
+
+func (c *httpClient) do(ctx context.Context, method, path, token string, body []byte, into interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.address+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("vault %s %s: %w", method, path, ErrNotFound)
+	case http.StatusForbidden:
+		return fmt.Errorf("vault %s %s: %w", method, path, ErrPermissionDenied)
+	case http.StatusNoContent:
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("unexpected status from vault %s %s: %s %v", method, path, resp.Status, e.Errors)
+	}
+	if into == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(into); err != nil {
+		return fmt.Errorf("failed to decode vault %s %s: %w", method, path, err)
+	}
+	return nil
+}
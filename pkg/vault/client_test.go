@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/dgerd/daytona-binding/pkg/vault/vaulttest"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := vaulttest.NewServer(t, "kubernetes", "app-role", "jwt")
+	s.SetVersion("secret/metadata/path/to/app", 3)
+	s.TokenTTL = time.Hour
+	c := NewClient(s.URL+"/", http.DefaultClient)
+
+	if _, err := c.Login(ctx, "kubernetes", "other-role", "jwt"); err == nil {
+		t.Error("Login() with the wrong role = nil, wanted error")
+	}
+	login, err := c.Login(ctx, "/kubernetes/", "app-role", "jwt")
+	if err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if login.TTL != time.Hour {
+		t.Errorf("Login().TTL = %v, want 1h", login.TTL)
+	}
+	token := login.ClientToken
+
+	for _, path := range []string{"secret/path/to/app", "/secret/data/path/to/app"} {
+		got, err := c.SecretVersion(ctx, token, path)
+		if err != nil {
+			t.Fatalf("SecretVersion(%q) = %v", path, err)
+		}
+		if got != 3 {
+			t.Errorf("SecretVersion(%q) = %d, want 3", path, got)
+		}
+	}
+
+	if _, err := c.SecretVersion(ctx, token, "secret/missing"); err == nil {
+		t.Error("SecretVersion() of a missing secret = nil, wanted error")
+	}
+	if _, err := c.SecretVersion(ctx, "bad-token", "secret/path/to/app"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SecretVersion() with a bad token = %v, want ErrPermissionDenied", err)
+	}
+
+	if err := c.RevokeSelf(ctx, token); err != nil {
+		t.Fatalf("RevokeSelf() = %v", err)
+	}
+	if s.Tokens() != 0 {
+		t.Errorf("Tokens() = %d after RevokeSelf(), want 0", s.Tokens())
+	}
+	if _, err := c.SecretVersion(ctx, token, "secret/path/to/app"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SecretVersion() with a revoked token = %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestClientPolicies(t *testing.T) {
+	ctx := context.Background()
+	s := vaulttest.NewServer(t, "kubernetes", "controller", "controller-jwt")
+	s.SetRole("app-role", "app-jwt", "app", "default")
+	s.SetCapabilities("app", "secret/data/app", "read", "list")
+	c := NewClient(s.URL, http.DefaultClient)
+
+	login, err := c.Login(ctx, "kubernetes", "controller", "controller-jwt")
+	if err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	token := login.ClientToken
+
+	mounts, err := c.AuthMounts(ctx, token)
+	if err != nil {
+		t.Fatalf("AuthMounts() = %v", err)
+	}
+	if got := mounts["kubernetes"]; got != "kubernetes" {
+		t.Errorf("AuthMounts()[kubernetes] = %q, want kubernetes", got)
+	}
+
+	policies, err := c.RolePolicies(ctx, token, "kubernetes", "app-role")
+	if err != nil {
+		t.Fatalf("RolePolicies() = %v", err)
+	}
+	if diff := cmp.Diff([]string{"app", "default"}, policies); diff != "" {
+		t.Errorf("RolePolicies() (-want, +got) = %s", diff)
+	}
+	if _, err := c.RolePolicies(ctx, token, "kubernetes", "typo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RolePolicies() of a missing role = %v, want ErrNotFound", err)
+	}
+
+	appToken, err := c.Login(ctx, "kubernetes", "app-role", "app-jwt")
+	if err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	caps, err := c.Capabilities(ctx, appToken.ClientToken, []string{"secret/data/app", "secret/data/other"})
+	if err != nil {
+		t.Fatalf("Capabilities() = %v", err)
+	}
+	want := map[string][]string{
+		"secret/data/app":   {"read", "list"},
+		"secret/data/other": {"deny"},
+	}
+	if diff := cmp.Diff(want, caps); diff != "" {
+		t.Errorf("Capabilities() (-want, +got) = %s", diff)
+	}
+}
+
+func TestCanRead(t *testing.T) {
+	tests := []struct {
+		caps []string
+		want bool
+	}{
+		{caps: []string{"read"}, want: true},
+		{caps: []string{"create", "read", "update"}, want: true},
+		{caps: []string{"root"}, want: true},
+		{caps: []string{"list"}},
+		{caps: []string{"deny"}},
+		{caps: []string{"read", "deny"}},
+		{},
+	}
+	for _, test := range tests {
+		if got := CanRead(test.caps); got != test.want {
+			t.Errorf("CanRead(%v) = %v, want %v", test.caps, got, test.want)
+		}
+	}
+}
+
+func TestMetadataPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{{
+		path: "secret/app",
+		want: "secret/metadata/app",
+	}, {
+		path: "secret/data/path/to/app",
+		want: "secret/metadata/path/to/app",
+	}, {
+		path: "/kv/app/",
+		want: "kv/metadata/app",
+	}, {
+		path:    "secret",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := MetadataPath(test.path)
+		if (err != nil) != test.wantErr {
+			t.Errorf("MetadataPath(%q) = %v, wantErr %v", test.path, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("MetadataPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
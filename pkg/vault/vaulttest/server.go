@@ -0,0 +1,215 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vaulttest provides an in-process fake of the Vault HTTP API
+// spoken by vault.Client.
+package vaulttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Token is the prefix of the Vault tokens handed out by a successful Login,
+// which are followed by the role logged in as and a serial number, e.g.
+// "s.fake-vault-token.app-role.1".
+const Token = "s.fake-vault-token"
+
+// Server is a fake Vault serving the kubernetes auth method mounted at
+// AuthMount, its roles, the capabilities their ACL policies grant and the
+// KV v2 metadata of the secrets it holds.
+type Server struct {
+	*httptest.Server
+
+	// AuthMount is the path the kubernetes auth method is mounted at.
+	AuthMount string
+
+	// TokenTTL is the TTL of the tokens handed out by Login, zero for
+	// tokens that don't expire.
+	TokenTTL time.Duration
+
+	mu       sync.Mutex
+	issued   int
+	tokens   map[string]string
+	jwts     map[string]string
+	roles    map[string][]string
+	policies map[string]map[string][]string
+	versions map[string]int64
+}
+
+// NewServer starts a Server whose role accepts the provided JWT, which is
+// closed when the test finishes.
+func NewServer(t *testing.T, authMount, role, jwt string) *Server {
+	s := &Server{
+		AuthMount: authMount,
+		tokens:    map[string]string{},
+		jwts:      map[string]string{},
+		roles:     map[string][]string{},
+		policies:  map[string]map[string][]string{},
+		versions:  map[string]int64{},
+	}
+	s.SetRole(role, jwt)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetRole creates or replaces a role of the kubernetes auth method, which
+// accepts the provided JWT and has the provided policies.
+func (s *Server) SetRole(role, jwt string, policies ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwts[role] = jwt
+	s.roles[role] = policies
+}
+
+// SetCapabilities sets the capabilities the named ACL policy grants on the
+// provided path, e.g. "secret/data/app".
+func (s *Server) SetCapabilities(policy, path string, capabilities ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policies[policy] == nil {
+		s.policies[policy] = map[string][]string{}
+	}
+	s.policies[policy][path] = capabilities
+}
+
+// SetVersion sets the current version of the secret with the provided KV
+// v2 metadata path, e.g. "secret/metadata/app".
+func (s *Server) SetVersion(path string, version int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[path] = version
+}
+
+// Tokens returns the number of tokens handed out by Login that weren't
+// revoked.
+func (s *Server) Tokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
+
+// Revoke revokes the provided token, as an operator would.
+func (s *Server) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if path == "auth/"+s.AuthMount+"/login" {
+		var body struct {
+			Role string `json:"role"`
+			JWT  string `json:"jwt"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil ||
+			body.JWT == "" || s.jwts[body.Role] != body.JWT {
+			writeErrors(w, http.StatusBadRequest, "permission denied")
+			return
+		}
+		s.issued++
+		token := fmt.Sprintf("%s.%s.%d", Token, body.Role, s.issued)
+		s.tokens[token] = body.Role
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": int64(s.TokenTTL / time.Second),
+			},
+		})
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	role, ok := s.tokens[token]
+	if !ok {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	if path == "auth/token/revoke-self" && r.Method == http.MethodPost {
+		delete(s.tokens, token)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if path == "sys/capabilities-self" {
+		s.capabilities(w, r, role)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeErrors(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data interface{}
+	switch {
+	case path == "sys/auth":
+		data = map[string]interface{}{
+			s.AuthMount + "/": map[string]string{"type": "kubernetes"},
+		}
+	case strings.HasPrefix(path, "auth/"+s.AuthMount+"/role/"):
+		if policies, ok := s.roles[strings.TrimPrefix(path, "auth/"+s.AuthMount+"/role/")]; ok {
+			data = map[string][]string{"token_policies": policies}
+		}
+	default:
+		if version, ok := s.versions[path]; ok {
+			data = map[string]int64{"current_version": version}
+		}
+	}
+	if data == nil {
+		writeErrors(w, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// capabilities answers sys/capabilities-self with the union of the
+// capabilities the policies of the role grant on each path, or deny.
+func (s *Server) capabilities(w http.ResponseWriter, r *http.Request, role string) {
+	var body struct {
+		Paths []string `json:"paths"`
+	}
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	data := map[string][]string{}
+	for _, path := range body.Paths {
+		var caps []string
+		for _, policy := range s.roles[role] {
+			caps = append(caps, s.policies[policy][path]...)
+		}
+		if len(caps) == 0 {
+			caps = []string{"deny"}
+		}
+		data[path] = caps
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func writeErrors(w http.ResponseWriter, code int, errors ...string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": errors})
+}